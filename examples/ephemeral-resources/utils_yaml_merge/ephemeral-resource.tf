@@ -0,0 +1,26 @@
+/*
+export DEVICE_PASSWORD=secret
+*/
+
+locals {
+  credentials = <<-EOT
+    device:
+      username: admin
+      password: !env DEVICE_PASSWORD
+  EOT
+}
+
+ephemeral "utils_yaml_merge" "credentials" {
+  input = [local.credentials]
+}
+
+locals {
+  device = yamldecode(ephemeral.utils_yaml_merge.credentials.output).device
+}
+
+# The resolved password is never written to the plan or state
+provider "nxos" {
+  username = local.device.username
+  password = local.device.password
+  url      = "https://10.1.1.1"
+}
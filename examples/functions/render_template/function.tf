@@ -0,0 +1,50 @@
+terraform {
+  required_providers {
+    utils = {
+      source = "netascode/utils"
+    }
+  }
+}
+
+# Configure the provider
+provider "utils" {}
+
+locals {
+  template = <<-EOT
+    hostname $${upper(name)}
+    %%{for server in ntp_servers~}
+    ntp server $${server} use-vrf $${try(vrf, "default")}
+    %%{endfor~}
+  EOT
+
+  vars = {
+    name        = "leaf1"
+    ntp_servers = ["10.0.0.1", "10.0.0.2"]
+  }
+
+  # Render a template to a string
+  config = provider::utils::render_template(local.template, local.vars, { trim_trailing_whitespace = true })
+
+  # Return the raw value of a single interpolation
+  servers = provider::utils::render_template("$${ntp_servers}", local.vars, { result_type = "value" })
+}
+
+output "config" {
+  value = local.config
+}
+
+output "servers" {
+  value = local.servers
+}
+
+/*
+config = <<EOT
+hostname LEAF1
+ntp server 10.0.0.1 use-vrf default
+ntp server 10.0.0.2 use-vrf default
+EOT
+servers = [
+  "10.0.0.1",
+  "10.0.0.2",
+]
+*/
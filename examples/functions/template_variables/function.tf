@@ -0,0 +1,46 @@
+terraform {
+  required_providers {
+    utils = {
+      source = "netascode/utils"
+    }
+  }
+}
+
+# Configure the provider
+provider "utils" {}
+
+locals {
+  template = <<-EOT
+    hostname $${name}
+    %%{for server in GLOBAL.ntp_servers~}
+    ntp server $${server} use-vrf $${upper(vrf)}
+    %%{endfor~}
+  EOT
+
+  # List references and function calls, and check them against the variables
+  analysis = provider::utils::template_variables(local.template, {
+    name   = "leaf1"
+    GLOBAL = { ntp_servers = ["10.0.0.1"] }
+  })
+}
+
+output "analysis" {
+  value = local.analysis
+}
+
+/*
+analysis = {
+  "functions" = tolist([
+    "upper",
+  ])
+  "undefined_variables" = tolist([
+    "vrf",
+  ])
+  "unknown_functions" = tolist([])
+  "variables" = tolist([
+    "GLOBAL.ntp_servers",
+    "name",
+    "vrf",
+  ])
+}
+*/
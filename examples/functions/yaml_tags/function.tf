@@ -0,0 +1,45 @@
+terraform {
+  required_providers {
+    utils = {
+      source = "netascode/utils"
+    }
+  }
+}
+
+# Configure the provider
+provider "utils" {}
+
+locals {
+  yaml_input = <<-EOT
+    name: myapp
+    database: !env DATABASE_URL
+    users:
+      - name: admin
+        password: !env ADMIN_PASSWORD
+  EOT
+
+  # List all tags without resolving them
+  tags = provider::utils::yaml_tags(provider::utils::yaml_decode(local.yaml_input))
+
+  # Environment variables required by the model
+  required_env = [for t in local.tags : t.argument if t.tag == "!env"]
+}
+
+output "tags" {
+  value = local.tags
+}
+
+/*
+tags = tolist([
+  {
+    "argument" = "DATABASE_URL"
+    "path" = "database"
+    "tag" = "!env"
+  },
+  {
+    "argument" = "ADMIN_PASSWORD"
+    "path" = "users[0].password"
+    "tag" = "!env"
+  },
+])
+*/
@@ -1,2 +1,12 @@
 provider "utils" {
+  # Optional: restrict which environment variables `!env` tags can read
+  # env_allowlist = ["NXOS_*", "DEVICE_*"]
+  # env_denylist  = ["AWS_*"]
+
+  # Optional: user-defined YAML tags, e.g. `asn: !site_asn` or `ip: !loopback 1`
+  # custom_tags = {
+  #   site_asn = { value = "65000" }
+  #   mgmt_vrf = { env = "MGMT_VRF" }
+  #   loopback = { template = "10.0.0.$${argument}" }
+  # }
 }
@@ -21,20 +21,40 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
 	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 )
 
 var _ datasource.DataSource = (*yamlMergeDataSource)(nil)
+var _ datasource.DataSourceWithConfigure = (*yamlMergeDataSource)(nil)
 
 func NewYamlMergeDataSource() datasource.DataSource {
 	return &yamlMergeDataSource{}
 }
 
-type yamlMergeDataSource struct{}
+type yamlMergeDataSource struct {
+	tagResolver *tagResolver
+}
+
+func (d *yamlMergeDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	data, ok := req.ProviderData.(*utilsProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected provider data",
+			fmt.Sprintf("Expected *utilsProviderData, got: %T", req.ProviderData),
+		)
+		return
+	}
+	d.tagResolver = data.tagResolver
+}
 
 func (d *yamlMergeDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
 	resp.TypeName = req.ProviderTypeName + "_yaml_merge"
@@ -43,7 +63,7 @@ func (d *yamlMergeDataSource) Metadata(_ context.Context, req datasource.Metadat
 func (d *yamlMergeDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
 	resp.Schema = schema.Schema{
 		// This description is used by the documentation generator and the language server.
-		MarkdownDescription: "Merge a list of YAML strings into a single YAML string, where maps are deep merged and list entries are compared against existing list entries and if all primitive values match, the entries are deep merged. YAML `!env` tags can be used to resolve values from environment variables.",
+		MarkdownDescription: "Merge a list of YAML strings into a single YAML string, where maps are deep merged and list entries are compared against existing list entries and if all primitive values match, the entries are deep merged. YAML `!env` tags can be used to resolve values from environment variables, `!age` tags and SOPS-encrypted documents are decrypted with the age identity from `SOPS_AGE_KEY` or `SOPS_AGE_KEY_FILE`. Transform tags (`!base64`, `!base64decode`, `!sha256`, `!json`, `!yaml`) can be stacked on other tags. `!ref path.to.value` tags are resolved against the merged result. User-defined tags can be declared in the provider `custom_tags` attribute, other unknown tags are reported as errors. The `tag_mode` attribute can preserve, strip or reject tags instead of resolving them. Access to environment variables can be restricted with the provider `env_allowlist` and `env_denylist` attributes.",
 
 		Attributes: map[string]schema.Attribute{
 			"id": schema.StringAttribute{
@@ -59,19 +79,36 @@ func (d *yamlMergeDataSource) Schema(ctx context.Context, req datasource.SchemaR
 				Description: "The merged output.",
 				Computed:    true,
 			},
+			"sensitive_output": schema.StringAttribute{
+				MarkdownDescription: "The merged output, marked as sensitive. Use this attribute instead of `output` if the input contains secrets, e.g. resolved `!env` or `!age` tags.",
+				Computed:            true,
+				Sensitive:           true,
+			},
+			"tagged_paths": schema.ListAttribute{
+				MarkdownDescription: "The key paths (e.g. `devices[0].password`) of the merged values that were set by a YAML tag or decrypted from a SOPS document, sorted.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
 			"merge_list_items": schema.BoolAttribute{
 				Description: "Merge list entries if all primitive values match. Default value is `true`.",
 				Optional:    true,
 			},
+			"tag_mode": schema.StringAttribute{
+				MarkdownDescription: "How YAML tags are handled: `resolve` resolves them, `preserve` keeps them as YAML tags in the output, `strip` replaces tagged values with `null` and `fail` returns an error if any tag is present. Default value is `resolve`.",
+				Optional:            true,
+			},
 		},
 	}
 }
 
 type YamlMerge struct {
-	Id             types.String `tfsdk:"id"`
-	Input          []string     `tfsdk:"input"`
-	Output         types.String `tfsdk:"output"`
-	MergeListItems types.Bool   `tfsdk:"merge_list_items"`
+	Id              types.String `tfsdk:"id"`
+	Input           []string     `tfsdk:"input"`
+	Output          types.String `tfsdk:"output"`
+	MergeListItems  types.Bool   `tfsdk:"merge_list_items"`
+	TagMode         types.String `tfsdk:"tag_mode"`
+	SensitiveOutput types.String `tfsdk:"sensitive_output"`
+	TaggedPaths     []string     `tfsdk:"tagged_paths"`
 }
 
 func (d *yamlMergeDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
@@ -88,51 +125,43 @@ func (d *yamlMergeDataSource) Read(ctx context.Context, req datasource.ReadReque
 		config.MergeListItems = types.BoolValue(true)
 	}
 
-	merged := NewOrderedMap(0)
-	for _, input := range config.Input {
-		decoded, err := yamlDecode(input)
-		if err != nil {
-			resp.Diagnostics.AddError(
-				"Error reading YAML string",
-				fmt.Sprintf("Error reading YAML string: %s", err),
-			)
-			return
-		}
-		if decoded == nil {
-			continue
-		}
+	tagMode := TagModeResolve
+	if !config.TagMode.IsUnknown() && !config.TagMode.IsNull() {
+		tagMode = config.TagMode.ValueString()
+	}
+	if !ValidTagModes[tagMode] {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("tag_mode"),
+			"Invalid tag_mode",
+			fmt.Sprintf("Invalid tag_mode '%s'. Must be one of: 'resolve', 'preserve', 'strip', 'fail'", tagMode),
+		)
+		return
+	}
 
-		resolved, err := resolveYamlTags(decoded)
+	resolver := d.tagResolver
+	if resolver == nil {
+		var err error
+		resolver, err = newTagResolverFromEnv()
 		if err != nil {
-			resp.Diagnostics.AddError(
-				"Error resolving YAML tags",
-				fmt.Sprintf("Error resolving YAML tags: %s", err),
-			)
+			resp.Diagnostics.AddError("Invalid environment variable policy", err.Error())
 			return
 		}
-
-		data, ok := resolved.(*OrderedMap)
-		if !ok {
-			resp.Diagnostics.AddError(
-				"Error reading YAML string",
-				"Expected a YAML mapping at the top level",
-			)
-			return
-		}
-
-		MergeMaps(data, merged, config.MergeListItems.ValueBool())
 	}
 
-	output, err := yamlEncode(merged)
+	output, paths, err := mergeYamlDocuments(config.Input, config.MergeListItems.ValueBool(), tagMode, resolver)
 	if err != nil {
-		resp.Diagnostics.AddError(
-			"Error converting result to YAML",
-			fmt.Sprintf("Error converting result to YAML: %s", err),
-		)
+		summary := "Error merging YAML"
+		var mergeErr *yamlMergeError
+		if errors.As(err, &mergeErr) {
+			summary = mergeErr.Summary
+		}
+		resp.Diagnostics.AddError(summary, err.Error())
 		return
 	}
 
 	config.Output = types.StringValue(output)
+	config.SensitiveOutput = types.StringValue(output)
+	config.TaggedPaths = paths
 
 	checksum := sha1.Sum([]byte(output))
 	config.Id = types.StringValue(hex.EncodeToString(checksum[:]))
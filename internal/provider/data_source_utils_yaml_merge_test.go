@@ -20,6 +20,7 @@ package provider
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
@@ -58,6 +59,136 @@ func TestAccDataSourceUtilsYamlMerge_EmptyDocuments(t *testing.T) {
 	})
 }
 
+func TestAccDataSourceUtilsYamlMerge_TagModePreserve(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					base = <<-EOT
+					device:
+					  name: leaf1
+					  password: !env DEVICE_PASSWORD
+					EOT
+					site = <<-EOT
+					device:
+					  banner: !base64 "!env BANNER"
+					EOT
+				}
+
+				data "utils_yaml_merge" "test" {
+					input    = [local.base, local.site]
+					tag_mode = "preserve"
+				}
+				`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.utils_yaml_merge.test", "output", "device:\n  name: leaf1\n  password: !env DEVICE_PASSWORD\n  banner: !base64 \"!env BANNER\"\n"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDataSourceUtilsYamlMerge_EnvDenylist(t *testing.T) {
+	t.Setenv("YAML_MERGE_SECRET", "secret")
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				provider "utils" {
+					env_denylist = ["YAML_MERGE_*"]
+				}
+
+				data "utils_yaml_merge" "test" {
+					input = ["password: !env YAML_MERGE_SECRET\n"]
+				}
+				`,
+				ExpectError: regexp.MustCompile(`YAML_MERGE_SECRET is blocked by denylist pattern\s+"YAML_MERGE_\*"`),
+			},
+		},
+	})
+}
+
+func TestAccDataSourceUtilsYamlMerge_SensitiveOutput(t *testing.T) {
+	t.Setenv("YAML_MERGE_PASSWORD", "secret")
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					base = <<-EOT
+					devices:
+					  - name: leaf1
+					    password: !env YAML_MERGE_PASSWORD
+					EOT
+					site = <<-EOT
+					devices:
+					  - name: leaf1
+					    site: dc1
+					EOT
+				}
+
+				data "utils_yaml_merge" "test" {
+					input = [local.base, local.site]
+				}
+				`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.utils_yaml_merge.test", "sensitive_output", "devices:\n  - name: leaf1\n    password: secret\n    site: dc1\n"),
+					resource.TestCheckResourceAttr("data.utils_yaml_merge.test", "tagged_paths.#", "1"),
+					resource.TestCheckResourceAttr("data.utils_yaml_merge.test", "tagged_paths.0", "devices[0].password"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDataSourceUtilsYamlMerge_CustomTags(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				provider "utils" {
+					custom_tags = {
+						site_asn = { value = "65000" }
+						loopback = { template = "10.0.0.$${argument}" }
+					}
+				}
+
+				locals {
+					input = <<-EOT
+					asn: !site_asn
+					loopback: !loopback 1
+					EOT
+				}
+
+				data "utils_yaml_merge" "test" {
+					input = [local.input]
+				}
+				`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.utils_yaml_merge.test", "output", "asn: 65000\nloopback: 10.0.0.1\n"),
+				),
+			},
+			{
+				Config: `
+				data "utils_yaml_merge" "test" {
+					input = ["asn: !site_asm\n"]
+				}
+				`,
+				ExpectError: regexp.MustCompile(`asn: unknown YAML tag !site_asm`),
+			},
+		},
+	})
+}
+
 func testAccDataSourceUtilsYamlMerge_emptyDocs() string {
 	return `
 	locals {
@@ -0,0 +1,164 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// groupPriority returns the priority of a device or interface group. Groups
+// with a higher priority are applied later and override groups with a lower
+// one; the default is 0.
+func groupPriority(group map[string]any) int {
+	return getIntVal(group, "priority", 0)
+}
+
+// checkGroupPriority reports a priority that is not an integer.
+func checkGroupPriority(kind string, group map[string]any) error {
+	v, ok := group["priority"]
+	if !ok || v == nil {
+		return nil
+	}
+	switch n := v.(type) {
+	case int, int64:
+		return nil
+	case float64:
+		if n == float64(int(n)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %q: priority must be an integer, got %v", kind, getStringVal(group, "name", ""), v)
+}
+
+// sortGroupsByPriority stably sorts groups by ascending priority, keeping the
+// given order for groups with the same priority.
+func sortGroupsByPriority(groups []map[string]any) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groupPriority(groups[i]) < groupPriority(groups[j])
+	})
+}
+
+// indexDeviceGroups returns the device groups by name and checks that every
+// priority is an integer, every parent_groups entry names an existing group
+// and the parent relation has no cycles.
+func indexDeviceGroups(deviceGroups []any) (map[string]map[string]any, error) {
+	byName := make(map[string]map[string]any, len(deviceGroups))
+	for _, dgRaw := range deviceGroups {
+		if dg, ok := dgRaw.(map[string]any); ok {
+			if err := checkGroupPriority("device group", dg); err != nil {
+				return nil, err
+			}
+			byName[getStringVal(dg, "name", "")] = dg
+		}
+	}
+
+	// 0 = unvisited, 1 = on the current path, 2 = done
+	state := make(map[string]int, len(byName))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			start := 0
+			for i, p := range path {
+				if p == name {
+					start = i
+				}
+			}
+			return fmt.Errorf("device group cycle detected: %s -> %s", strings.Join(path[start:], " -> "), name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		path = append(path, name)
+		for _, parent := range getStringSlice(byName[name], "parent_groups") {
+			if _, ok := byName[parent]; !ok {
+				return fmt.Errorf("device group %q: parent group %q not found", name, parent)
+			}
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = 2
+		return nil
+	}
+	for _, dgRaw := range deviceGroups {
+		if dg, ok := dgRaw.(map[string]any); ok {
+			if err := visit(getStringVal(dg, "name", "")); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return byName, nil
+}
+
+// matchingDeviceGroups returns the device groups that apply to device, in the
+// order their variables, templates and configuration are applied. Directly
+// matched groups are sorted by priority, then by model order, and each is
+// preceded by its ancestors: parent_groups are expanded depth-first, again by
+// priority and then in the order listed, so a parent always comes before its
+// children and a group shared by several branches is applied only once, at its
+// first position.
+func (rctx *renderContext) matchingDeviceGroups(device map[string]any) []map[string]any {
+	var result []map[string]any
+	seen := make(map[string]bool)
+	var add func(dg map[string]any)
+	add = func(dg map[string]any) {
+		name := getStringVal(dg, "name", "")
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		var parents []map[string]any
+		for _, parent := range getStringSlice(dg, "parent_groups") {
+			if p, ok := rctx.deviceGroupsByName[parent]; ok {
+				parents = append(parents, p)
+			}
+		}
+		sortGroupsByPriority(parents)
+		for _, p := range parents {
+			add(p)
+		}
+		result = append(result, dg)
+	}
+	var matched []map[string]any
+	for _, dgRaw := range rctx.deviceGroups {
+		dg, ok := dgRaw.(map[string]any)
+		if ok && deviceMatchesGroup(device, dg) {
+			matched = append(matched, dg)
+		}
+	}
+	sortGroupsByPriority(matched)
+	for _, dg := range matched {
+		add(dg)
+	}
+	return result
+}
+
+// orderInterfaceGroups returns the interface groups referenced by an interface
+// in the order they are applied: by priority, then in the order listed.
+func orderInterfaceGroups(names []string, priorities map[string]int) []string {
+	ordered := append([]string(nil), names...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return priorities[ordered[i]] < priorities[ordered[j]]
+	})
+	return ordered
+}
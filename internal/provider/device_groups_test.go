@@ -0,0 +1,149 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testDeviceGroupNames(groups []map[string]any) []string {
+	var names []string
+	for _, g := range groups {
+		names = append(names, getStringVal(g, "name", ""))
+	}
+	return names
+}
+
+func TestMatchingDeviceGroups_AncestorsFirst(t *testing.T) {
+	deviceGroups := []any{
+		map[string]any{"name": "leafs", "parent_groups": []any{"dc1", "fabric"}},
+		map[string]any{"name": "border", "parent_groups": []any{"leafs"}, "devices": []any{"leaf1"}},
+		map[string]any{"name": "fabric"},
+		map[string]any{"name": "dc1", "parent_groups": []any{"fabric"}},
+		map[string]any{"name": "monitoring"},
+	}
+	byName, err := indexDeviceGroups(deviceGroups)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rctx := &renderContext{deviceGroups: deviceGroups, deviceGroupsByName: byName}
+
+	device := map[string]any{"name": "leaf1", "device_groups": []any{"monitoring"}}
+	got := testDeviceGroupNames(rctx.matchingDeviceGroups(device))
+	expected := []string{"fabric", "dc1", "leafs", "border", "monitoring"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if got := rctx.matchingDeviceGroups(map[string]any{"name": "spine1"}); len(got) != 0 {
+		t.Errorf("expected no groups, got %v", testDeviceGroupNames(got))
+	}
+}
+
+func TestIndexDeviceGroups_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []any
+		expected string
+	}{
+		{
+			name: "unknown parent",
+			groups: []any{
+				map[string]any{"name": "leafs", "parent_groups": []any{"missing"}},
+			},
+			expected: `device group "leafs": parent group "missing" not found`,
+		},
+		{
+			name: "cycle",
+			groups: []any{
+				map[string]any{"name": "a", "parent_groups": []any{"b"}},
+				map[string]any{"name": "b", "parent_groups": []any{"c"}},
+				map[string]any{"name": "c", "parent_groups": []any{"b"}},
+			},
+			expected: "device group cycle detected: b -> c -> b",
+		},
+		{
+			name: "self parent",
+			groups: []any{
+				map[string]any{"name": "a", "parent_groups": []any{"a"}},
+			},
+			expected: "device group cycle detected: a -> a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := indexDeviceGroups(tt.groups)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestMatchingDeviceGroups_Priority(t *testing.T) {
+	deviceGroups := []any{
+		map[string]any{"name": "site", "priority": 20, "parent_groups": []any{"region", "base"}},
+		map[string]any{"name": "role", "priority": 10},
+		map[string]any{"name": "tenant"},
+		map[string]any{"name": "region", "priority": 5},
+		map[string]any{"name": "base", "priority": 1},
+	}
+	byName, err := indexDeviceGroups(deviceGroups)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rctx := &renderContext{deviceGroups: deviceGroups, deviceGroupsByName: byName}
+
+	device := map[string]any{"name": "leaf1", "device_groups": []any{"site", "role", "tenant"}}
+	got := testDeviceGroupNames(rctx.matchingDeviceGroups(device))
+	expected := []string{"tenant", "role", "base", "region", "site"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestOrderInterfaceGroups(t *testing.T) {
+	priorities := map[string]int{"a": 10, "b": 0, "c": -1, "d": 0}
+	names := []string{"a", "b", "c", "d", "unknown"}
+	got := orderInterfaceGroups(names, priorities)
+	expected := []string{"c", "b", "d", "unknown", "a"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if names[0] != "a" {
+		t.Error("expected input slice to be left unchanged")
+	}
+}
+
+func TestIndexDeviceGroups_InvalidPriority(t *testing.T) {
+	for _, priority := range []any{"high", 1.5, true} {
+		_, err := indexDeviceGroups([]any{map[string]any{"name": "leafs", "priority": priority}})
+		if err == nil || !strings.Contains(err.Error(), `device group "leafs": priority must be an integer`) {
+			t.Errorf("priority %v: expected integer error, got %v", priority, err)
+		}
+	}
+	if _, err := indexDeviceGroups([]any{map[string]any{"name": "leafs", "priority": float64(3)}}); err != nil {
+		t.Errorf("unexpected error for integral float priority: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// selector is one parsed entry of managed_devices or managed_device_groups.
+// It matches a device or device group by name or by labels.
+type selector struct {
+	exclude bool
+	match   func(name string, labels map[string]any) bool
+}
+
+// parseSelector parses a selector entry:
+//   - "!selector" excludes what the selector matches
+//   - "/regex/" matches names against the whole regular expression
+//   - "key=value,key!=value" matches labels; all requirements must hold
+//   - "spine*" matches names with a glob pattern (*, ? and [...])
+//   - anything else matches the exact name
+func parseSelector(s string) (selector, error) {
+	var sel selector
+	if strings.HasPrefix(s, "!") {
+		sel.exclude = true
+		s = s[1:]
+	}
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return sel, fmt.Errorf("empty selector")
+	case len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/"):
+		re, err := regexp.Compile("^(?:" + s[1:len(s)-1] + ")$")
+		if err != nil {
+			return sel, fmt.Errorf("invalid regular expression %q: %w", s, err)
+		}
+		sel.match = func(name string, _ map[string]any) bool { return re.MatchString(name) }
+	case strings.Contains(s, "="):
+		requirements, err := parseLabelSelector(s)
+		if err != nil {
+			return sel, err
+		}
+		sel.match = func(_ string, labels map[string]any) bool { return matchLabels(requirements, labels) }
+	case strings.ContainsAny(s, "*?["):
+		if _, err := path.Match(s, ""); err != nil {
+			return sel, fmt.Errorf("invalid glob pattern %q: %w", s, err)
+		}
+		sel.match = func(name string, _ map[string]any) bool {
+			ok, _ := path.Match(s, name)
+			return ok
+		}
+	default:
+		sel.match = func(name string, _ map[string]any) bool { return name == s }
+	}
+	return sel, nil
+}
+
+// labelRequirement is one "key=value" or "key!=value" term of a label selector.
+type labelRequirement struct {
+	key    string
+	value  string
+	negate bool
+}
+
+// parseLabelSelector parses a comma-separated list of label requirements.
+func parseLabelSelector(s string) ([]labelRequirement, error) {
+	var requirements []labelRequirement
+	for _, term := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label selector %q: expected key=value or key!=value, got %q", s, term)
+		}
+		req := labelRequirement{key: strings.TrimSpace(key), value: strings.TrimSpace(value)}
+		if strings.HasSuffix(req.key, "!") {
+			req.negate = true
+			req.key = strings.TrimSpace(strings.TrimSuffix(req.key, "!"))
+		}
+		if req.key == "" {
+			return nil, fmt.Errorf("invalid label selector %q: empty label key", s)
+		}
+		requirements = append(requirements, req)
+	}
+	return requirements, nil
+}
+
+// matchLabels reports whether labels satisfy all requirements. A missing label
+// satisfies only "key!=value" requirements.
+func matchLabels(requirements []labelRequirement, labels map[string]any) bool {
+	for _, req := range requirements {
+		v, ok := labels[req.key]
+		equal := ok && v != nil && fmt.Sprint(v) == req.value
+		if equal == req.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSelectors parses a list of selector entries.
+func parseSelectors(entries []string) ([]selector, error) {
+	selectors := make([]selector, 0, len(entries))
+	for _, e := range entries {
+		sel, err := parseSelector(e)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+	}
+	return selectors, nil
+}
+
+// selectorsMatch reports whether a candidate passes a list of selectors: it must
+// match at least one including selector, unless there are none, and no
+// excluding selector. matches reports whether a single selector matches.
+func selectorsMatch(selectors []selector, matches func(selector) bool) bool {
+	included, hasInclude := false, false
+	for _, sel := range selectors {
+		if sel.exclude {
+			if matches(sel) {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		if !included && matches(sel) {
+			included = true
+		}
+	}
+	return included || !hasInclude
+}
+
+// managedFilter selects the devices to render from the managed_devices and
+// managed_device_groups selectors. An empty list selects everything.
+type managedFilter struct {
+	devices []selector
+	groups  []selector
+}
+
+// newManagedFilter parses the managed_devices and managed_device_groups lists.
+func newManagedFilter(managedDevices, managedGroups []string) (*managedFilter, error) {
+	devices, err := parseSelectors(managedDevices)
+	if err != nil {
+		return nil, fmt.Errorf("managed_devices: %w", err)
+	}
+	groups, err := parseSelectors(managedGroups)
+	if err != nil {
+		return nil, fmt.Errorf("managed_device_groups: %w", err)
+	}
+	return &managedFilter{devices: devices, groups: groups}, nil
+}
+
+// matchDevice reports whether the device passes both selector lists. Device
+// selectors match the device name and labels; group selectors match the name and
+// labels of the groups the device belongs to, including ancestor groups.
+func (f *managedFilter) matchDevice(rctx *renderContext, device map[string]any) bool {
+	name := getStringVal(device, "name", "")
+	labels := getMapVal(device, "labels")
+	if !selectorsMatch(f.devices, func(sel selector) bool { return sel.match(name, labels) }) {
+		return false
+	}
+	if len(f.groups) == 0 {
+		return true
+	}
+	groups := rctx.matchingDeviceGroups(device)
+	return selectorsMatch(f.groups, func(sel selector) bool {
+		for _, dg := range groups {
+			if sel.match(getStringVal(dg, "name", ""), getMapVal(dg, "labels")) {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	labels := map[string]any{"site": "dc1", "role": "leaf", "rack": 12}
+
+	tests := []struct {
+		selector string
+		name     string
+		expected bool
+		exclude  bool
+	}{
+		{selector: "leaf1", name: "leaf1", expected: true},
+		{selector: "leaf1", name: "leaf10", expected: false},
+		{selector: "leaf*", name: "leaf10", expected: true},
+		{selector: "leaf?", name: "leaf10", expected: false},
+		{selector: "leaf[12]", name: "leaf2", expected: true},
+		{selector: "/leaf[0-9]+/", name: "leaf10", expected: true},
+		{selector: "/leaf/", name: "leaf10", expected: false},
+		{selector: "!spine*", name: "spine1", expected: true, exclude: true},
+		{selector: "site=dc1", name: "x", expected: true},
+		{selector: "site=dc1, role=leaf", name: "x", expected: true},
+		{selector: "site=dc1,role=spine", name: "x", expected: false},
+		{selector: "role!=border", name: "x", expected: true},
+		{selector: "tier!=core", name: "x", expected: true},
+		{selector: "tier=core", name: "x", expected: false},
+		{selector: "rack=12", name: "x", expected: true},
+		{selector: "!site=dc2", name: "x", expected: false, exclude: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := parseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sel.exclude != tt.exclude {
+				t.Errorf("expected exclude %v, got %v", tt.exclude, sel.exclude)
+			}
+			if got := sel.match(tt.name, labels); got != tt.expected {
+				t.Errorf("match(%q): expected %v, got %v", tt.name, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseSelector_Errors(t *testing.T) {
+	for _, s := range []string{"", "!", "/leaf[/", "leaf[", "site=dc1,role", "=dc1"} {
+		if _, err := parseSelector(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestFilterManagedDevices_Selectors(t *testing.T) {
+	deviceGroups := []any{
+		map[string]any{"name": "fabric", "labels": map[string]any{"env": "prod"}},
+		map[string]any{"name": "leafs", "parent_groups": []any{"fabric"}, "devices": []any{"leaf1", "leaf2"}},
+		map[string]any{"name": "lab", "devices": []any{"leaf3"}},
+	}
+	byName, err := indexDeviceGroups(deviceGroups)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rctx := &renderContext{
+		deviceGroups:       deviceGroups,
+		deviceGroupsByName: byName,
+		devices: []any{
+			map[string]any{"name": "spine1", "labels": map[string]any{"site": "dc1", "role": "spine"}},
+			map[string]any{"name": "leaf1", "labels": map[string]any{"site": "dc1", "role": "leaf"}},
+			map[string]any{"name": "leaf2", "labels": map[string]any{"site": "dc2", "role": "leaf"}},
+			map[string]any{"name": "leaf3", "labels": map[string]any{"site": "dc1", "role": "leaf"}},
+		},
+	}
+
+	tests := []struct {
+		devices  []string
+		groups   []string
+		expected []string
+	}{
+		{expected: []string{"spine1", "leaf1", "leaf2", "leaf3"}},
+		{devices: []string{"!spine*"}, expected: []string{"leaf1", "leaf2", "leaf3"}},
+		{devices: []string{"leaf*", "!leaf3"}, expected: []string{"leaf1", "leaf2"}},
+		{devices: []string{"site=dc1"}, expected: []string{"spine1", "leaf1", "leaf3"}},
+		{devices: []string{"/leaf[12]/", "spine1"}, expected: []string{"spine1", "leaf1", "leaf2"}},
+		{groups: []string{"fabric"}, expected: []string{"leaf1", "leaf2"}},
+		{groups: []string{"env=prod"}, expected: []string{"leaf1", "leaf2"}},
+		{groups: []string{"!lab"}, expected: []string{"spine1", "leaf1", "leaf2"}},
+		{devices: []string{"site=dc1"}, groups: []string{"leafs"}, expected: []string{"leaf1"}},
+	}
+
+	for _, tt := range tests {
+		filter, err := newManagedFilter(tt.devices, tt.groups)
+		if err != nil {
+			t.Fatalf("%v %v: unexpected error: %v", tt.devices, tt.groups, err)
+		}
+		var got []string
+		for _, d := range filterManagedDevices(rctx, filter) {
+			got = append(got, getStringVal(d.(map[string]any), "name", ""))
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%v %v: expected %v, got %v", tt.devices, tt.groups, tt.expected, got)
+		}
+	}
+}
+
+func TestNewManagedFilter_ErrorNamesParameter(t *testing.T) {
+	_, err := newManagedFilter(nil, []string{"/[/"})
+	if err == nil || !strings.HasPrefix(err.Error(), "managed_device_groups: invalid regular expression") {
+		t.Errorf("expected managed_device_groups error, got %v", err)
+	}
+}
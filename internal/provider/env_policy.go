@@ -0,0 +1,116 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// envAllowlistVar and envDenylistVar configure which environment variables
+	// `!env` tags may read when resolved by provider functions.
+	envAllowlistVar = "UTILS_ENV_ALLOWLIST"
+	envDenylistVar  = "UTILS_ENV_DENYLIST"
+)
+
+// envPolicy restricts the environment variables that `!env` tags can read. Patterns
+// use shell glob syntax (e.g. "NXOS_*"). A variable is blocked if it matches a
+// denylist pattern, or if an allowlist is configured and it matches none of its
+// patterns. The sources name where each list was configured, for error messages.
+type envPolicy struct {
+	allow       []string
+	deny        []string
+	allowSource string
+	denySource  string
+}
+
+// newEnvPolicy validates the given patterns and returns a policy, or nil if there is
+// neither an allowlist nor a denylist. A nil allowlist allows all variables, while an
+// empty one blocks them all.
+func newEnvPolicy(allow, deny []string, allowSource, denySource string) (*envPolicy, error) {
+	if allow == nil && len(deny) == 0 {
+		return nil, nil
+	}
+	for _, p := range allow {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid environment variable pattern %q in %s: %w", p, allowSource, err)
+		}
+	}
+	for _, p := range deny {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid environment variable pattern %q in %s: %w", p, denySource, err)
+		}
+	}
+	return &envPolicy{allow: allow, deny: deny, allowSource: allowSource, denySource: denySource}, nil
+}
+
+// envPolicyFromEnv builds the policy configured through the UTILS_ENV_ALLOWLIST and
+// UTILS_ENV_DENYLIST environment variables, each a comma-separated list of patterns.
+func envPolicyFromEnv() (*envPolicy, error) {
+	return newEnvPolicy(splitPatternList(os.Getenv(envAllowlistVar)), splitPatternList(os.Getenv(envDenylistVar)), envAllowlistVar, envDenylistVar)
+}
+
+// providerEnvPolicy builds the policy configured through the provider env_allowlist
+// and env_denylist attributes. Each list that is not configured (nil) falls back to
+// UTILS_ENV_ALLOWLIST or UTILS_ENV_DENYLIST respectively.
+func providerEnvPolicy(allow, deny []string) (*envPolicy, error) {
+	allowSource, denySource := "provider env_allowlist", "provider env_denylist"
+	if allow == nil {
+		allow, allowSource = splitPatternList(os.Getenv(envAllowlistVar)), envAllowlistVar
+	}
+	if deny == nil {
+		deny, denySource = splitPatternList(os.Getenv(envDenylistVar)), envDenylistVar
+	}
+	return newEnvPolicy(allow, deny, allowSource, denySource)
+}
+
+// splitPatternList splits a comma-separated list, dropping empty entries.
+func splitPatternList(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// check returns an error naming the variable and the rule if name is blocked.
+// A nil policy allows all variables.
+func (p *envPolicy) check(name string) error {
+	if p == nil {
+		return nil
+	}
+	for _, pattern := range p.deny {
+		if ok, _ := path.Match(pattern, name); ok {
+			return fmt.Errorf("access to environment variable %s is blocked by denylist pattern %q in %s", name, pattern, p.denySource)
+		}
+	}
+	if p.allow == nil {
+		return nil
+	}
+	for _, pattern := range p.allow {
+		if ok, _ := path.Match(pattern, name); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("access to environment variable %s is blocked: it does not match any allowlist pattern (%s) in %s", name, strings.Join(p.allow, ", "), p.allowSource)
+}
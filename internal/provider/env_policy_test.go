@@ -0,0 +1,93 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvPolicy_Check(t *testing.T) {
+	policy, err := newEnvPolicy([]string{"NXOS_*", "DEVICE_PASSWORD"}, []string{"NXOS_SECRET_*"}, "allowlist", "denylist")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{"NXOS_USERNAME", ""},
+		{"DEVICE_PASSWORD", ""},
+		{"NXOS_SECRET_TOKEN", `blocked by denylist pattern "NXOS_SECRET_*" in denylist`},
+		{"AWS_SECRET_ACCESS_KEY", "does not match any allowlist pattern (NXOS_*, DEVICE_PASSWORD) in allowlist"},
+	}
+	for _, tt := range tests {
+		err := policy.check(tt.name)
+		if tt.message == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.message) || !strings.Contains(err.Error(), tt.name) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.message, err)
+		}
+	}
+}
+
+func TestEnvPolicy_DenylistOnly(t *testing.T) {
+	policy, err := newEnvPolicy(nil, []string{"AWS_*"}, "allowlist", "denylist")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := policy.check("HOME"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := policy.check("AWS_SECRET_ACCESS_KEY"); err == nil {
+		t.Error("expected AWS_SECRET_ACCESS_KEY to be blocked")
+	}
+}
+
+func TestEnvPolicy_InvalidPattern(t *testing.T) {
+	if _, err := newEnvPolicy([]string{"NXOS_["}, nil, "allowlist", "denylist"); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestResolveYamlTags_EnvPolicyFromEnv(t *testing.T) {
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("NXOS_USERNAME", "admin")
+	t.Setenv(envDenylistVar, "AWS_*, GITHUB_TOKEN")
+
+	result, err := resolveYamlTags(map[string]any{"user": "!env NXOS_USERNAME"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.(map[string]any)["user"] != "admin" {
+		t.Errorf("expected 'admin', got %v", result.(map[string]any)["user"])
+	}
+
+	_, err = resolveYamlTags(map[string]any{"key": "!base64 !env AWS_SECRET_ACCESS_KEY"})
+	if err == nil {
+		t.Fatal("expected blocked variable error")
+	}
+	if !strings.HasPrefix(err.Error(), "key: ") || !strings.Contains(err.Error(), "UTILS_ENV_DENYLIST") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
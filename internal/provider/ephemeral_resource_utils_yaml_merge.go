@@ -0,0 +1,155 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+var _ ephemeral.EphemeralResource = (*yamlMergeEphemeralResource)(nil)
+var _ ephemeral.EphemeralResourceWithConfigure = (*yamlMergeEphemeralResource)(nil)
+
+func NewYamlMergeEphemeralResource() ephemeral.EphemeralResource {
+	return &yamlMergeEphemeralResource{}
+}
+
+type yamlMergeEphemeralResource struct {
+	tagResolver *tagResolver
+}
+
+func (r *yamlMergeEphemeralResource) Metadata(_ context.Context, req ephemeral.MetadataRequest, resp *ephemeral.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_yaml_merge"
+}
+
+func (r *yamlMergeEphemeralResource) Schema(ctx context.Context, req ephemeral.SchemaRequest, resp *ephemeral.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Merge a list of YAML strings into a single YAML string, like the `utils_yaml_merge` data source, without persisting the result to the plan or state. Use this ephemeral resource if the input contains secrets, e.g. `!env` or `!age` tags or SOPS-encrypted documents, that are needed to configure other providers. User-defined tags can be declared in the provider `custom_tags` attribute.",
+
+		Attributes: map[string]schema.Attribute{
+			"input": schema.ListAttribute{
+				Description: "A list of YAML strings that is merged into the `output` attribute.",
+				ElementType: types.StringType,
+				Required:    true,
+			},
+			"output": schema.StringAttribute{
+				Description: "The merged output.",
+				Computed:    true,
+				Sensitive:   true,
+			},
+			"merge_list_items": schema.BoolAttribute{
+				Description: "Merge list entries if all primitive values match. Default value is `true`.",
+				Optional:    true,
+			},
+			"tag_mode": schema.StringAttribute{
+				Description: "How YAML tags are handled: `resolve` resolves them, `preserve` keeps them as YAML tags in the output, `strip` replaces tagged values with `null` and `fail` returns an error if any tag is present. Default value is `resolve`.",
+				Optional:    true,
+			},
+			"tagged_paths": schema.ListAttribute{
+				Description: "The key paths (e.g. `devices[0].password`) of the merged values that were set by a YAML tag or decrypted from a SOPS document, sorted.",
+				ElementType: types.StringType,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func (r *yamlMergeEphemeralResource) Configure(_ context.Context, req ephemeral.ConfigureRequest, resp *ephemeral.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	data, ok := req.ProviderData.(*utilsProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected provider data",
+			fmt.Sprintf("Expected *utilsProviderData, got: %T", req.ProviderData),
+		)
+		return
+	}
+	r.tagResolver = data.tagResolver
+}
+
+type YamlMergeEphemeral struct {
+	Input          []string     `tfsdk:"input"`
+	Output         types.String `tfsdk:"output"`
+	MergeListItems types.Bool   `tfsdk:"merge_list_items"`
+	TagMode        types.String `tfsdk:"tag_mode"`
+	TaggedPaths    []string     `tfsdk:"tagged_paths"`
+}
+
+func (r *yamlMergeEphemeralResource) Open(ctx context.Context, req ephemeral.OpenRequest, resp *ephemeral.OpenResponse) {
+	var config YamlMergeEphemeral
+
+	// Read config
+	diags := req.Config.Get(ctx, &config)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if config.MergeListItems.IsUnknown() || config.MergeListItems.IsNull() {
+		config.MergeListItems = types.BoolValue(true)
+	}
+
+	tagMode := TagModeResolve
+	if !config.TagMode.IsUnknown() && !config.TagMode.IsNull() {
+		tagMode = config.TagMode.ValueString()
+	}
+	if !ValidTagModes[tagMode] {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("tag_mode"),
+			"Invalid tag_mode",
+			fmt.Sprintf("Invalid tag_mode '%s'. Must be one of: 'resolve', 'preserve', 'strip', 'fail'", tagMode),
+		)
+		return
+	}
+
+	resolver := r.tagResolver
+	if resolver == nil {
+		var err error
+		resolver, err = newTagResolverFromEnv()
+		if err != nil {
+			resp.Diagnostics.AddError("Invalid environment variable policy", err.Error())
+			return
+		}
+	}
+
+	output, paths, err := mergeYamlDocuments(config.Input, config.MergeListItems.ValueBool(), tagMode, resolver)
+	if err != nil {
+		summary := "Error merging YAML"
+		var mergeErr *yamlMergeError
+		if errors.As(err, &mergeErr) {
+			summary = mergeErr.Summary
+		}
+		resp.Diagnostics.AddError(summary, err.Error())
+		return
+	}
+
+	config.Output = types.StringValue(output)
+	config.TaggedPaths = paths
+
+	diags = resp.Result.Set(ctx, &config)
+	resp.Diagnostics.Append(diags...)
+}
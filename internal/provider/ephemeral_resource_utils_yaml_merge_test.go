@@ -0,0 +1,78 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-testing/echoprovider"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/knownvalue"
+	"github.com/hashicorp/terraform-plugin-testing/statecheck"
+	"github.com/hashicorp/terraform-plugin-testing/tfjsonpath"
+	"github.com/hashicorp/terraform-plugin-testing/tfversion"
+)
+
+func TestAccEphemeralResourceUtilsYamlMerge(t *testing.T) {
+	t.Setenv("EPHEMERAL_YAML_MERGE_PASSWORD", "secret")
+	resource.Test(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_10_0),
+		},
+		PreCheck: func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: map[string]func() (tfprotov6.ProviderServer, error){
+			"utils": testAccProtoV6ProviderFactories["utils"],
+			"echo":  echoprovider.NewProviderServer(),
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					base = <<-EOT
+					device:
+					  name: leaf1
+					  password: !env EPHEMERAL_YAML_MERGE_PASSWORD
+					EOT
+					site = <<-EOT
+					device:
+					  site: dc1
+					EOT
+				}
+
+				ephemeral "utils_yaml_merge" "test" {
+					input = [local.base, local.site]
+				}
+
+				provider "echo" {
+					data = {
+						output       = ephemeral.utils_yaml_merge.test.output
+						tagged_paths = ephemeral.utils_yaml_merge.test.tagged_paths
+					}
+				}
+
+				resource "echo" "test" {}
+				`,
+				ConfigStateChecks: []statecheck.StateCheck{
+					statecheck.ExpectKnownValue("echo.test", tfjsonpath.New("data").AtMapKey("output"), knownvalue.StringExact("device:\n  name: leaf1\n  password: secret\n  site: dc1\n")),
+					statecheck.ExpectKnownValue("echo.test", tfjsonpath.New("data").AtMapKey("tagged_paths"), knownvalue.ListExact([]knownvalue.Check{knownvalue.StringExact("device.password")})),
+				},
+			},
+		},
+	})
+}
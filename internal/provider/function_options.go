@@ -0,0 +1,183 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Option names accepted in the trailing "options" object of functions
+const (
+	OptionTagMode                = "tag_mode"
+	OptionStrict                 = "strict"
+	OptionResultType             = "result_type"
+	OptionTrimTrailingWhitespace = "trim_trailing_whitespace"
+	OptionCustomTags             = "custom_tags"
+
+	OptionMaxTemplateOutputSize     = "max_template_output_size"
+	OptionMaxTemplateCollectionSize = "max_template_collection_size"
+	OptionProvenance                = "provenance"
+	OptionSchemas                   = "schemas"
+)
+
+// parseFunctionOptions converts the variadic "options" argument of a function into
+// a native map. At most one options object may be passed and only the given keys
+// are accepted, so that misspelled options are reported instead of ignored.
+func parseFunctionOptions(args []types.Dynamic, allowed ...string) (map[string]any, error) {
+	if len(args) == 0 {
+		return map[string]any{}, nil
+	}
+	if len(args) > 1 {
+		return nil, fmt.Errorf("expected at most one options object, got %d", len(args))
+	}
+	if args[0].IsNull() {
+		return map[string]any{}, nil
+	}
+	if args[0].IsUnknown() {
+		return nil, fmt.Errorf("options must be known")
+	}
+
+	native, err := convertDynamicToNative(args[0])
+	if err != nil {
+		return nil, err
+	}
+	opts, ok := native.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("options must be an object, got %T", native)
+	}
+
+	allowedSet := toStringSet(allowed)
+	var unknown []string
+	for k := range opts {
+		if !allowedSet[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unsupported option(s): %s (supported: %s)", strings.Join(unknown, ", "), strings.Join(allowed, ", "))
+	}
+	return opts, nil
+}
+
+// optionString returns the string option key, or def if it is not set.
+func optionString(opts map[string]any, key, def string) (string, error) {
+	v, ok := opts[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("option %s must be a string, got %T", key, v)
+	}
+	return s, nil
+}
+
+// optionBool returns the boolean option key, or def if it is not set.
+func optionBool(opts map[string]any, key string, def bool) (bool, error) {
+	v, ok := opts[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("option %s must be a bool, got %T", key, v)
+	}
+	return b, nil
+}
+
+// optionPositiveInt returns the whole number option key, or def if it is not set.
+func optionPositiveInt(opts map[string]any, key string, def int) (int, error) {
+	v, ok := opts[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	i, ok := v.(int)
+	if !ok || i <= 0 {
+		return 0, fmt.Errorf("option %s must be a positive whole number, got %v", key, v)
+	}
+	return i, nil
+}
+
+// optionTagMode returns the validated tag_mode option, defaulting to "resolve".
+func optionTagMode(opts map[string]any) (string, error) {
+	mode, err := optionString(opts, OptionTagMode, TagModeResolve)
+	if err != nil {
+		return "", err
+	}
+	if !ValidTagModes[mode] {
+		return "", fmt.Errorf("invalid tag_mode '%s'. Must be one of: 'resolve', 'preserve', 'strip', 'fail'", mode)
+	}
+	return mode, nil
+}
+
+// optionCustomTags returns the user-defined YAML tags of the custom_tags option, a
+// map of tag name to an object with one of value, env or template, like the
+// custom_tags provider attribute.
+func optionCustomTags(opts map[string]any) (map[string]customTag, error) {
+	v, ok := opts[OptionCustomTags]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	tags, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("option %s must be a map of tag name to tag definition, got %T", OptionCustomTags, v)
+	}
+	config := make(map[string]customTagModel, len(tags))
+	for name, raw := range tags {
+		def, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("option %s: tag %s must be an object with value, env or template, got %T", OptionCustomTags, name, raw)
+		}
+		model := customTagModel{Value: types.StringNull(), Env: types.StringNull(), Template: types.StringNull()}
+		for key, field := range def {
+			if field == nil {
+				continue
+			}
+			var value types.String
+			switch f := field.(type) {
+			case string:
+				value = types.StringValue(f)
+			case int, int64, float64, bool:
+				value = types.StringValue(fmt.Sprint(f))
+			default:
+				return nil, fmt.Errorf("option %s: tag %s: %s must be a string, got %T", OptionCustomTags, name, key, field)
+			}
+			switch key {
+			case "value":
+				model.Value = value
+			case "env":
+				model.Env = value
+			case "template":
+				model.Template = value
+			default:
+				return nil, fmt.Errorf("option %s: tag %s: unsupported attribute %q (supported: value, env, template)", OptionCustomTags, name, key)
+			}
+		}
+		config[name] = model
+	}
+	custom, err := newCustomTags(config)
+	if err != nil {
+		return nil, fmt.Errorf("option %s: %w", OptionCustomTags, err)
+	}
+	return custom, nil
+}
@@ -20,6 +20,9 @@ package provider
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,10 +30,14 @@ import (
 	"github.com/hashicorp/terraform-plugin-framework/function"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/zclconf/go-cty/cty"
+	ctyfunction "github.com/zclconf/go-cty/cty/function"
 )
 
 var _ function.Function = RenderDeviceConfigsFunction{}
 
+// listIndexRegexp matches the list indices of a key path, e.g. "[0]" in "interfaces.ethernets[0].mtu".
+var listIndexRegexp = regexp.MustCompile(`\[\d+\]`)
+
 func NewRenderDeviceConfigsFunction() function.Function {
 	return &RenderDeviceConfigsFunction{}
 }
@@ -46,8 +53,49 @@ func (r RenderDeviceConfigsFunction) Definition(_ context.Context, _ function.De
 		Summary: "Render per-device configurations from a hierarchical Network-as-Code model",
 		MarkdownDescription: "Processes a Network as Code model structure to produce fully rendered per-device configurations. " +
 			"Handles template evaluation, deep merging with precedence cascade (global → group → device), " +
-			"interface group merging, and CLI template collection. Supports nxos, iosxe, and iosxr architectures.\n\n" +
+			"interface group merging, and CLI template collection. Supports nxos, iosxe, and iosxr architectures. " +
+			"A model may contain several architecture keys, e.g. `nxos` and `iosxe`: each is rendered with its own templates, groups and defaults, " +
+			"`raw` and `resolved` are keyed by architecture and `provider_devices` combines the devices of all architectures, each with its `architecture`. " +
+			"In model templates, a value consisting of a single expression such as `${GLOBAL.ntp_servers}` keeps its type, " +
+			"so lists, maps and objects from variables can be injected as whole subtrees.\n\n" +
+			"SOPS-encrypted YAML strings are decrypted before merging, so `raw` as well as `resolved` contains the decrypted values. `!ref path.to.value` tags are resolved against the merged model, " +
+			"while `!env`, `!age` and transform tags (`!base64`, `!base64decode`, `!sha256`, `!json`, `!yaml`) are resolved in the `resolved` output, tags declared in the `custom_tags` option are resolved and other unknown tags are reported as errors. " +
+			"The optional `tag_mode` option can preserve, strip or reject tags instead of resolving them. " +
+			"The `tagged_paths` result lists the key paths of the values set by YAML tags or decrypted from SOPS documents, e.g. to decide which values to mark as sensitive. " +
+			"A decrypted value is listed at its configuration path in every device it can apply to, also where a later level overrides it; values passed through variables are not listed. " +
+			"With the `provenance` option, the `provenance` result maps each architecture, device name and configuration leaf path (e.g. `system.mtu`) to the `level` " +
+			"(`global`, `group`, `device`, `defaults` or `interface_group`) and `source` (template name, `template/group`, group name, `configuration`, `defaults` or interface group name) that set it, " +
+			"and whether it is a `default`; it is `null` otherwise. " +
+			"age identities are read from `SOPS_AGE_KEY` or `SOPS_AGE_KEY_FILE`. " +
+			"Access to environment variables can be restricted with the comma-separated `UTILS_ENV_ALLOWLIST` and `UTILS_ENV_DENYLIST` environment variables.\n\n" +
 			"~> This function is intended for use within the [Network as Code](https://netascode.cisco.com/) Terraform modules and is not intended for standalone use.\n\n" +
+			"## Device Groups\n\n" +
+			"A device belongs to a device group if the device lists it in `device_groups` or the group lists the device in `devices`. " +
+			"A group can list other groups in `parent_groups`; a device that belongs to a group also belongs to all of its ancestors. " +
+			"Group variables, templates and configuration are applied after `global` and before the device, later groups overriding earlier ones. " +
+			"The groups are sorted by their integer `priority` (default `0`, higher priorities are applied later and win) and, for equal priorities, by the order of the model's `device_groups` list. " +
+			"Each group is preceded by its parent groups, sorted the same way by priority and then in the order listed (recursively), and every group is applied once, at its first position. " +
+			"A parent is therefore always applied before its children, whatever their priorities. Unknown parent groups and cycles are reported as errors.\n\n" +
+			"The interface groups referenced by an interface's `interface_groups` are likewise applied by ascending `priority`, then in the order listed. " +
+			"As the order of merged lists depends on the order of the YAML inputs, set distinct priorities on groups that configure the same values.\n\n" +
+			"## Managed Devices\n\n" +
+			"Each entry of `managed_devices` and `managed_device_groups` is a selector: an exact name, a glob pattern (`spine*`, `leaf-?`, `leaf[12]`), " +
+			"a regular expression matching the whole name (`/leaf[0-9]+/`) or a label selector (`site=dc1,role!=border`) matching all of the given `labels` of the device or device group. " +
+			"A selector prefixed with `!` excludes what it matches (e.g. `!spine*`). " +
+			"A device is selected by a list if it matches at least one including selector, or the list has only exclusions, and no excluding selector. " +
+			"For `managed_device_groups`, the selectors are matched against the groups the device belongs to, including ancestor groups. " +
+			"Devices must be selected by both lists.\n\n" +
+			"## Conditions\n\n" +
+			"Entries of the model's `templates` list and interface groups accept a `when` condition, and so do template assignments: " +
+			"entries of a `templates` list of `global`, a device group or a device can be objects with a `name` and a `when` condition instead of template names. " +
+			"A condition is a boolean or an HCL expression string evaluated with the device variables (including the variables of the group for group assignments) and the template functions, " +
+			"e.g. `role == \"leaf\" && startswith(version, \"10.\")`. Templates and interface groups whose conditions are false are skipped. " +
+			"Conditions that fail to evaluate or do not return a boolean are reported as errors.\n\n" +
+			"## Schema Validation\n\n" +
+			"With the `schemas` option, the `configuration` of every rendered device of an architecture is validated against the JSON Schema given for it, " +
+			"after templates, defaults and interface groups are applied and YAML tags are resolved. Schemas default to draft 2020-12 and cannot reference external documents; " +
+			"architectures without a schema are not validated and a schema for an architecture missing from the model is reported as an error. All failures of all devices are reported in one error, each with the architecture, device name, " +
+			"configuration path (e.g. `interfaces.ethernets[0].mtu`) and reason, e.g. a misspelled `interfaces.ethernet` key rejected by `additionalProperties: false`.\n\n" +
 			"## Template Functions\n\n" +
 			"The following functions are available inside `${}` template expressions in model templates, " +
 			"file templates, and CLI templates:\n\n" +
@@ -60,10 +108,26 @@ func (r RenderDeviceConfigsFunction) Definition(_ context.Context, _ function.De
 			"`range`, `reverse`, `setintersection`, `setproduct`, `setsubtract`, `setunion`, `slice`, " +
 			"`values`, `zipmap`\n\n" +
 			"**Type Conversion:** `tobool`, `tonumber`, `tostring`\n\n" +
-			"**Encoding:** `base64decode`, `base64encode`, `csvdecode`, `jsondecode`, `jsonencode`\n\n" +
+			"**Encoding:** `base64decode`, `base64encode`, `csvdecode`, `jsondecode`, `jsonencode`, `urlencode`, `yamldecode`, `yamlencode`\n\n" +
+			"**Hashing and UUID:** `base64sha256`, `base64sha512`, `md5`, `sha1`, `sha256`, `sha512`, `uuidv5`\n\n" +
 			"**Date/Time:** `formatdate`, `timeadd`\n\n" +
+			"**Network:** `cidrcontains`, `cidrhost`, `cidrnetmask`, `cidrprefixlen`, `cidrsubnet`, `cidrsubnets`, " +
+			"`ipexpand`, `ipversion`\n\n" +
+			"**Normalization:** `normalize_bgp_rd`, `normalize_bgp_rt`, `normalize_mac`, `normalize_mask`, `normalize_vlans` " +
+			"(same arguments and results as the provider functions of the same name)\n\n" +
 			"**Boolean:** `alltrue`, `anytrue`\n\n" +
-			"**Error Handling:** `try`, `can`",
+			"**Error Handling:** `try`, `can`\n\n" +
+			"**Includes:** `include` (CLI and file templates only). `include(\"name\", { var = value })` renders another `cli` or `file` entry of the model's `templates` list, " +
+			"or an entry of `file_templates` by path, with the current variables plus the optional overrides. Include cycles are reported with the include chain.\n\n" +
+			"## User-Defined Functions\n\n" +
+			"Entries of the model's `templates` list with `type: function` declare functions available to all templates of the render. " +
+			"`parameters` lists parameter names or objects with `name` and `type` (`any`, `string`, `number`, `bool`, `list` or `object`), " +
+			"and `expression` is an HCL expression evaluated with the parameters as variables, e.g. `\"uplink to ${peer} ${port}\"`. " +
+			"Functions can call built-in and other user-defined functions; nested calls are limited to a depth of 32.\n\n" +
+			"## Resource Limits\n\n" +
+			"Each template evaluation is limited in the size of its output (`max_template_output_size`, default 10 MiB, including included templates) " +
+			"and in the number of elements of each collection returned by `range` or `setproduct` or iterated by a `for` expression (`max_template_collection_size`, default 100000). " +
+			"Rendering also stops when the function times out after 60 seconds. Exceeding a limit is reported as an error naming the device and template.",
 		Parameters: []function.Parameter{
 			function.ListParameter{
 				Name:                "yaml_strings",
@@ -85,19 +149,30 @@ func (r RenderDeviceConfigsFunction) Definition(_ context.Context, _ function.De
 			function.ListParameter{
 				Name:                "managed_devices",
 				ElementType:         types.StringType,
-				MarkdownDescription: "List of device names to manage. Empty list means all devices.",
+				MarkdownDescription: "List of device selectors (names, globs, `/regex/`, label selectors or `!` exclusions) to manage. Empty list means all devices.",
 			},
 			function.ListParameter{
 				Name:                "managed_device_groups",
 				ElementType:         types.StringType,
-				MarkdownDescription: "List of device group names to manage. Empty list means all device groups.",
+				MarkdownDescription: "List of device group selectors (names, globs, `/regex/`, label selectors or `!` exclusions) to manage. A device matches if it belongs to a selected group or to any descendant of one. Empty list means all device groups.",
 			},
 		},
+		VariadicParameter: function.DynamicParameter{
+			Name:           "options",
+			AllowNullValue: true,
+			MarkdownDescription: "An optional object with additional settings. `tag_mode` controls how YAML tags are handled: `resolve` (default) resolves them in the `resolved` output, `preserve` keeps them in both outputs, `strip` replaces tagged values with `null` and `fail` returns an error if any tag is present. " +
+				"`max_template_output_size` (bytes) and `max_template_collection_size` (elements) override the resource limits of each template evaluation. " +
+				"`provenance` (default `false`) enables the `provenance` result. " +
+				"`custom_tags` declares user-defined YAML tags like the provider `custom_tags` attribute; other unknown tags are reported as errors. " +
+				"`schemas` maps architectures to JSON Schemas, as objects or JSON strings, that the `configuration` of each device must match.",
+		},
 		Return: function.ObjectReturn{
 			AttributeTypes: map[string]attr.Type{
 				"raw":              types.DynamicType,
 				"resolved":         types.DynamicType,
 				"provider_devices": types.DynamicType,
+				"tagged_paths":     types.ListType{ElemType: types.StringType},
+				"provenance":       types.DynamicType,
 			},
 		},
 	}
@@ -110,25 +185,71 @@ func (r RenderDeviceConfigsFunction) Run(ctx context.Context, req function.RunRe
 	var fileTemplatesDynamic types.Dynamic
 	var managedDevicesTF []string
 	var managedGroupsTF []string
+	var options []types.Dynamic
 
-	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &yamlStrings, &modelDynamic, &defaultsYaml, &fileTemplatesDynamic, &managedDevicesTF, &managedGroupsTF))
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &yamlStrings, &modelDynamic, &defaultsYaml, &fileTemplatesDynamic, &managedDevicesTF, &managedGroupsTF, &options))
 	if resp.Error != nil {
 		return
 	}
 
+	opts, err := parseFunctionOptions(options, OptionTagMode, OptionMaxTemplateOutputSize, OptionMaxTemplateCollectionSize, OptionProvenance, OptionSchemas, OptionCustomTags)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	tagMode, err := optionTagMode(opts)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	maxOutputSize, err := optionPositiveInt(opts, OptionMaxTemplateOutputSize, DefaultMaxTemplateOutputSize)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	maxCollectionSize, err := optionPositiveInt(opts, OptionMaxTemplateCollectionSize, DefaultMaxTemplateCollectionSize)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	trackProvenance, err := optionBool(opts, OptionProvenance, false)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	schemas, err := compileConfigSchemas(opts[OptionSchemas])
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+
+	resolver, err := newFunctionTagResolver(opts)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
-	// 1. YAML decode + merge (preserving !env tags as literal strings)
+	// 1. YAML decode + merge (decrypting SOPS documents, preserving !env tags as literal strings).
+	// The paths of the decrypted values are mapped through the merge as in mergeYamlDocuments.
 	merged := NewOrderedMap(0)
+	sopsPaths := map[string]bool{}
 	for _, yamlStr := range yamlStrings {
 		decoded, err := yamlDecode(yamlStr)
 		if err != nil {
 			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error decoding YAML string: "+err.Error()))
 			return
 		}
+		paths := sopsEncryptedPaths(decoded)
+		decoded, err = decryptSopsDocument(decoded)
+		if err != nil {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error decrypting SOPS document: "+err.Error()))
+			return
+		}
 		if decoded != nil {
-			MergeMaps(decoded, merged, true)
+			mergeSopsPaths(decoded, merged, paths, sopsPaths)
 		}
 	}
 
@@ -139,7 +260,25 @@ func (r RenderDeviceConfigsFunction) Run(ctx context.Context, req function.RunRe
 		return
 	}
 	if modelNative != nil {
-		MergeMaps(modelNative, merged, true)
+		mergeSopsPaths(modelNative, merged, nil, sopsPaths)
+	}
+
+	// 2b. Resolve !ref tags against the fully merged model, or strip/reject all tags
+	switch tagMode {
+	case TagModeResolve:
+		resolvedRefs, err := resolveYamlRefs(merged)
+		if err != nil {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error resolving YAML references: "+err.Error()))
+			return
+		}
+		merged = resolvedRefs.(*OrderedMap)
+	case TagModeStrip, TagModeFail:
+		handled, err := resolver.applyTagMode(merged, tagMode)
+		if err != nil {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error resolving YAML tags: "+err.Error()))
+			return
+		}
+		merged = handled.(*OrderedMap)
 	}
 
 	// 3. Defaults merge: extract user defaults from model, merge with module defaults
@@ -152,7 +291,7 @@ func (r RenderDeviceConfigsFunction) Run(ctx context.Context, req function.RunRe
 		}
 		if moduleDefaults != nil {
 			// Resolve !env tags in defaults (they may reference env vars)
-			moduleDefaults, err = resolveYamlTags(moduleDefaults)
+			moduleDefaults, err = resolver.applyTagMode(moduleDefaults, tagMode)
 			if err != nil {
 				resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error resolving defaults YAML tags: "+err.Error()))
 				return
@@ -204,23 +343,27 @@ func (r RenderDeviceConfigsFunction) Run(ctx context.Context, req function.RunRe
 		}
 	}
 
-	// 6. Discover architecture and build provider_devices
-	arch, err := discoverArchitecture(model)
+	// 6. Discover architectures and build provider_devices
+	archs, err := discoverArchitectures(model)
 	if err != nil {
 		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error discovering architecture: "+err.Error()))
 		return
 	}
-	defaultManaged := getBoolVal(getMapVal(getMapVal(defaults, arch), "devices"), "managed", true)
-	providerDevices := buildProviderDevices(model, arch, defaultManaged)
+	providerDevices := []any{}
+	for _, arch := range archs {
+		defaultManaged := getBoolVal(getMapVal(getMapVal(defaults, arch), "devices"), "managed", true)
+		providerDevices = append(providerDevices, buildProviderDevices(model, arch, defaultManaged)...)
+	}
 
 	// 7. Run the render pipeline
-	result, err := renderDeviceConfigs(model, fileTemplates, managedDevicesTF, managedGroupsTF, defaults)
+	limits := newTemplateLimits(ctx, maxOutputSize, maxCollectionSize)
+	result, provenance, err := renderDeviceConfigs(model, fileTemplates, managedDevicesTF, managedGroupsTF, defaults, limits, trackProvenance)
 	if err != nil {
 		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error rendering device configs: "+err.Error()))
 		return
 	}
 
-	// 8. Produce raw output (strip nulls, preserve !env tags)
+	// 8. Produce raw output (strip nulls, preserve !env tags; SOPS values are already decrypted)
 	rawResult := stripNulls(result)
 	rawDynamic, err := convertNativeToDynamic(ctx, rawResult)
 	if err != nil {
@@ -228,13 +371,20 @@ func (r RenderDeviceConfigsFunction) Run(ctx context.Context, req function.RunRe
 		return
 	}
 
-	// 9. Produce resolved output (resolve !env tags, strip nulls)
-	resolvedNative, err := resolveYamlTags(result)
+	// 9. Produce resolved output (resolve !env tags according to tag_mode, strip nulls)
+	resolvedNative, err := resolver.applyTagMode(result, tagMode)
 	if err != nil {
 		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error resolving YAML tags: "+err.Error()))
 		return
 	}
-	resolvedResult := stripNulls(resolvedNative)
+	resolvedResult := stripNulls(orderedMapToPlainMap(resolvedNative))
+
+	// 9b. Validate the device configurations against the architecture schemas
+	if err := validateDeviceConfigs(resolvedResult, schemas); err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error validating device configs: "+err.Error()))
+		return
+	}
+
 	resolvedDynamic, err := convertNativeToDynamic(ctx, resolvedResult)
 	if err != nil {
 		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting resolved result: "+err.Error()))
@@ -249,17 +399,38 @@ func (r RenderDeviceConfigsFunction) Run(ctx context.Context, req function.RunRe
 		return
 	}
 
-	// 11. Construct ObjectValue
+	// 11. Produce tagged_paths output (paths of values set by YAML tags or decrypted from SOPS documents)
+	taggedPathsList, diags := types.ListValueFrom(ctx, types.StringType, sortedUnion(taggedPaths(result), sopsResultPaths(model, sopsPaths, result)))
+	if diags.HasError() {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("failed to convert tagged_paths: %s", diags)))
+		return
+	}
+
+	// 12. Produce provenance output (null unless requested)
+	provenanceDynamic := types.DynamicNull()
+	if provenance != nil {
+		provenanceDynamic, err = convertNativeToDynamic(ctx, provenance)
+		if err != nil {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting provenance: "+err.Error()))
+			return
+		}
+	}
+
+	// 13. Construct ObjectValue
 	objValue, diags := types.ObjectValue(
 		map[string]attr.Type{
 			"raw":              types.DynamicType,
 			"resolved":         types.DynamicType,
 			"provider_devices": types.DynamicType,
+			"tagged_paths":     types.ListType{ElemType: types.StringType},
+			"provenance":       types.DynamicType,
 		},
 		map[string]attr.Value{
 			"raw":              rawDynamic,
 			"resolved":         resolvedDynamic,
 			"provider_devices": pdDynamic,
+			"tagged_paths":     taggedPathsList,
+			"provenance":       provenanceDynamic,
 		},
 	)
 	if diags.HasError() {
@@ -272,35 +443,73 @@ func (r RenderDeviceConfigsFunction) Run(ctx context.Context, req function.RunRe
 
 // renderContext holds parsed state for the rendering pipeline.
 type renderContext struct {
-	arch            string
-	archConfig      map[string]any
-	global          map[string]any
-	devices         []any
-	deviceGroups    []any
-	interfaceGroups []any
-	templates       map[string]map[string]any
-	fileTemplates   map[string]string
-	defaultOrder    int
-	defaultManaged  bool
-	defaultConfig   map[string]any // defaults[arch].devices.configuration
+	arch                     string
+	archConfig               map[string]any
+	global                   map[string]any
+	devices                  []any
+	deviceGroups             []any
+	deviceGroupsByName       map[string]map[string]any
+	interfaceGroups          []any
+	interfaceGroupPriorities map[string]int
+	templates                map[string]map[string]any
+	fileTemplates            map[string]string
+	functions                map[string]ctyfunction.Function // built-in and model-defined template functions
+	limits                   *templateLimits                 // resource limits for each template evaluation
+	provenance               map[string]any                  // device name → path → source, nil unless tracked
+	defaultOrder             int
+	defaultManaged           bool
+	defaultConfig            map[string]any // defaults[arch].devices.configuration
 }
 
-// renderDeviceConfigs is the core pipeline.
-func renderDeviceConfigs(model map[string]any, fileTemplates map[string]string, managedDevices, managedGroups []string, defaults map[string]any) (map[string]any, error) {
-	// 1. Discover architecture
-	arch, err := discoverArchitecture(model)
+// renderDeviceConfigs is the core pipeline. Every architecture key of the model
+// is rendered separately, with its own templates, groups and defaults. If
+// trackProvenance is set, the source of every configuration leaf is returned per
+// architecture and device; otherwise the returned provenance is nil.
+func renderDeviceConfigs(model map[string]any, fileTemplates map[string]string, managedDevices, managedGroups []string, defaults map[string]any, limits *templateLimits, trackProvenance bool) (map[string]any, map[string]any, error) {
+	// 1. Discover architectures
+	archs, err := discoverArchitectures(model)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	filter, err := newManagedFilter(managedDevices, managedGroups)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	result := make(map[string]any, len(archs))
+	var provenance map[string]any
+	if trackProvenance {
+		provenance = make(map[string]any, len(archs))
+	}
+	for _, arch := range archs {
+		rendered, archProvenance, err := renderArchitecture(model, arch, fileTemplates, filter, defaults, limits, trackProvenance)
+		if err != nil {
+			if len(archs) > 1 {
+				return nil, nil, fmt.Errorf("%s: %w", arch, err)
+			}
+			return nil, nil, err
+		}
+		result[arch] = rendered
+		if trackProvenance {
+			provenance[arch] = archProvenance
+		}
+	}
+	return result, provenance, nil
+}
+
+// renderArchitecture renders the managed devices of a single architecture.
+func renderArchitecture(model map[string]any, arch string, fileTemplates map[string]string, filter *managedFilter, defaults map[string]any, limits *templateLimits, trackProvenance bool) (map[string]any, map[string]any, error) {
 	// 2. Extract context
-	rctx, err := extractRenderContext(model, arch, fileTemplates, defaults)
+	rctx, err := extractRenderContext(model, arch, fileTemplates, defaults, limits)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if trackProvenance {
+		rctx.provenance = map[string]any{}
 	}
 
 	// 3. Filter managed devices
-	managed := filterManagedDevices(rctx, managedDevices, managedGroups)
+	managed := filterManagedDevices(rctx, filter)
 
 	// 4. Process each device
 	renderedDevices := make([]any, 0, len(managed))
@@ -310,39 +519,40 @@ func renderDeviceConfigs(model map[string]any, fileTemplates map[string]string,
 			continue
 		}
 
+		if err := limits.checkContext(); err != nil {
+			return nil, nil, fmt.Errorf("device %v: %w", getStringVal(device, "name", ""), err)
+		}
 		rendered, err := renderSingleDevice(rctx, device)
 		if err != nil {
-			return nil, fmt.Errorf("device %v: %w", getStringVal(device, "name", ""), err)
+			return nil, nil, fmt.Errorf("device %v: %w", getStringVal(device, "name", ""), err)
 		}
 		renderedDevices = append(renderedDevices, rendered)
 	}
 
 	// 5. Return result
 	return map[string]any{
-		arch: map[string]any{
-			"devices": renderedDevices,
-		},
-	}, nil
+		"devices": renderedDevices,
+	}, rctx.provenance, nil
 }
 
-func discoverArchitecture(model map[string]any) (string, error) {
-	var arch string
+// discoverArchitectures returns the sorted architecture keys of the model, i.e.
+// all top-level keys except "defaults".
+func discoverArchitectures(model map[string]any) ([]string, error) {
+	var archs []string
 	for k := range model {
 		if k == "defaults" {
 			continue
 		}
-		if arch != "" {
-			return "", fmt.Errorf("multiple architecture keys found: %q and %q", arch, k)
-		}
-		arch = k
+		archs = append(archs, k)
 	}
-	if arch == "" {
-		return "", fmt.Errorf("no architecture key found in model (only 'defaults' present)")
+	if len(archs) == 0 {
+		return nil, fmt.Errorf("no architecture key found in model (only 'defaults' present)")
 	}
-	return arch, nil
+	sort.Strings(archs)
+	return archs, nil
 }
 
-func extractRenderContext(model map[string]any, arch string, fileTemplates map[string]string, defaults map[string]any) (*renderContext, error) {
+func extractRenderContext(model map[string]any, arch string, fileTemplates map[string]string, defaults map[string]any, limits *templateLimits) (*renderContext, error) {
 	archConfig := getMapVal(model, arch)
 	defaultsArch := getMapVal(defaults, arch)
 
@@ -357,78 +567,66 @@ func extractRenderContext(model map[string]any, arch string, fileTemplates map[s
 		}
 	}
 
+	// Compile user-defined template functions
+	functions, err := compileTemplateFunctions(templatesList, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceGroups := getSliceVal(archConfig, "device_groups")
+	deviceGroupsByName, err := indexDeviceGroups(deviceGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaceGroups := getSliceVal(archConfig, "interface_groups")
+	interfaceGroupPriorities := make(map[string]int, len(interfaceGroups))
+	for _, igRaw := range interfaceGroups {
+		if ig, ok := igRaw.(map[string]any); ok {
+			if err := checkGroupPriority("interface group", ig); err != nil {
+				return nil, err
+			}
+			interfaceGroupPriorities[getStringVal(ig, "name", "")] = groupPriority(ig)
+		}
+	}
+
 	return &renderContext{
-		arch:            arch,
-		archConfig:      archConfig,
-		global:          getMapVal(archConfig, "global"),
-		devices:         getSliceVal(archConfig, "devices"),
-		deviceGroups:    getSliceVal(archConfig, "device_groups"),
-		interfaceGroups: getSliceVal(archConfig, "interface_groups"),
-		templates:       templates,
-		fileTemplates:   fileTemplates,
-		defaultOrder:    getIntVal(getMapVal(defaultsArch, "templates"), "order", 0),
-		defaultManaged:  getBoolVal(getMapVal(defaultsArch, "devices"), "managed", true),
-		defaultConfig:   getMapVal(getMapVal(defaultsArch, "devices"), "configuration"),
+		arch:                     arch,
+		archConfig:               archConfig,
+		global:                   getMapVal(archConfig, "global"),
+		devices:                  getSliceVal(archConfig, "devices"),
+		deviceGroups:             deviceGroups,
+		deviceGroupsByName:       deviceGroupsByName,
+		interfaceGroups:          interfaceGroups,
+		interfaceGroupPriorities: interfaceGroupPriorities,
+		templates:                templates,
+		fileTemplates:            fileTemplates,
+		functions:                functions,
+		limits:                   limits,
+		defaultOrder:             getIntVal(getMapVal(defaultsArch, "templates"), "order", 0),
+		defaultManaged:           getBoolVal(getMapVal(defaultsArch, "devices"), "managed", true),
+		defaultConfig:            getMapVal(getMapVal(defaultsArch, "devices"), "configuration"),
 	}, nil
 }
 
-func filterManagedDevices(rctx *renderContext, managedDevices, managedGroups []string) []any {
-	if len(managedDevices) == 0 && len(managedGroups) == 0 {
+func filterManagedDevices(rctx *renderContext, filter *managedFilter) []any {
+	if len(filter.devices) == 0 && len(filter.groups) == 0 {
 		return rctx.devices
 	}
 
-	managedDeviceSet := toStringSet(managedDevices)
-	managedGroupSet := toStringSet(managedGroups)
-
 	var result []any
 	for _, deviceRaw := range rctx.devices {
 		device, ok := deviceRaw.(map[string]any)
 		if !ok {
 			continue
 		}
-		name := getStringVal(device, "name", "")
-
-		// Check managed_devices filter
-		if len(managedDeviceSet) > 0 && !managedDeviceSet[name] {
-			continue
-		}
-
-		// Check managed_device_groups filter
-		if len(managedGroupSet) > 0 {
-			if !deviceInAnyManagedGroup(device, rctx.deviceGroups, managedGroupSet) {
-				continue
-			}
+		if filter.matchDevice(rctx, device) {
+			result = append(result, deviceRaw)
 		}
-
-		result = append(result, deviceRaw)
 	}
 	return result
 }
 
-func deviceInAnyManagedGroup(device map[string]any, deviceGroups []any, managedGroupSet map[string]bool) bool {
-	deviceName := getStringVal(device, "name", "")
-	deviceGroupNames := getStringSlice(device, "device_groups")
-
-	for _, dgRaw := range deviceGroups {
-		dg, ok := dgRaw.(map[string]any)
-		if !ok {
-			continue
-		}
-		dgName := getStringVal(dg, "name", "")
-		if !managedGroupSet[dgName] {
-			continue
-		}
-		// Bidirectional: device lists the group OR group lists the device
-		if containsString(deviceGroupNames, dgName) {
-			return true
-		}
-		if containsString(getStringSlice(dg, "devices"), deviceName) {
-			return true
-		}
-	}
-	return false
-}
-
 func deviceMatchesGroup(device map[string]any, group map[string]any) bool {
 	deviceName := getStringVal(device, "name", "")
 	dgName := getStringVal(group, "name", "")
@@ -449,19 +647,15 @@ func renderSingleDevice(rctx *renderContext, device map[string]any) (map[string]
 	}
 
 	// 4b. Process file templates
-	globalFileTmpls, err := processFileTemplates(rctx, getStringSlice(rctx.global, "templates"), ctyVars)
+	globalFileTmpls, err := processFileTemplates(rctx, templateAssignments(rctx.global), ctyVars)
 	if err != nil {
 		return nil, fmt.Errorf("global file templates: %w", err)
 	}
 
-	var groupFileTmpls []map[string]any
-	var groupModelTmpls []map[string]any
-	var groupConfigs []map[string]any
-	for _, dgRaw := range rctx.deviceGroups {
-		dg, ok := dgRaw.(map[string]any)
-		if !ok || !deviceMatchesGroup(device, dg) {
-			continue
-		}
+	var groupFileTmpls []configLayer
+	var groupModelTmpls []configLayer
+	var groupConfigs []configLayer
+	for _, dg := range rctx.matchingDeviceGroups(device) {
 		// Group file templates with extra group variables
 		groupVars := mergeShallow(deviceVars, getMapVal(dg, "variables"))
 		groupCtyVars, err := nativeToCtyMap(groupVars)
@@ -469,81 +663,91 @@ func renderSingleDevice(rctx *renderContext, device map[string]any) (map[string]
 			return nil, fmt.Errorf("group %q vars: %w", getStringVal(dg, "name", ""), err)
 		}
 
-		ft, err := processFileTemplates(rctx, getStringSlice(dg, "templates"), groupCtyVars)
+		dgName := getStringVal(dg, "name", "")
+		ft, err := processFileTemplates(rctx, templateAssignments(dg), groupCtyVars)
 		if err != nil {
-			return nil, fmt.Errorf("group %q file templates: %w", getStringVal(dg, "name", ""), err)
+			return nil, fmt.Errorf("group %q file templates: %w", dgName, err)
+		}
+		for i := range ft {
+			ft[i].source = fmt.Sprintf("%s/%s", ft[i].source, dgName)
 		}
 		groupFileTmpls = append(groupFileTmpls, ft...)
 
 		// Group model templates
-		mt, err := processModelTemplates(rctx, getStringSlice(dg, "templates"), groupCtyVars)
+		mt, err := processModelTemplates(rctx, templateAssignments(dg), groupCtyVars, ProvenanceLevelGroup, dgName)
 		if err != nil {
-			return nil, fmt.Errorf("group %q model templates: %w", getStringVal(dg, "name", ""), err)
+			return nil, fmt.Errorf("group %q model templates: %w", dgName, err)
 		}
 		groupModelTmpls = append(groupModelTmpls, mt)
 
 		// Group configuration
 		if cfg := getMapVal(dg, "configuration"); len(cfg) > 0 {
-			groupConfigs = append(groupConfigs, cfg)
+			groupConfigs = append(groupConfigs, configLayer{source: dgName, config: cfg})
 		}
 	}
 
-	deviceFileTmpls, err := processFileTemplates(rctx, getStringSlice(device, "templates"), ctyVars)
+	deviceFileTmpls, err := processFileTemplates(rctx, templateAssignments(device), ctyVars)
 	if err != nil {
 		return nil, fmt.Errorf("device file templates: %w", err)
 	}
 
 	// 4c. Process model templates
-	globalModelTmpl, err := processModelTemplates(rctx, getStringSlice(rctx.global, "templates"), ctyVars)
+	globalModelTmpl, err := processModelTemplates(rctx, templateAssignments(rctx.global), ctyVars, ProvenanceLevelGlobal, "")
 	if err != nil {
 		return nil, fmt.Errorf("global model templates: %w", err)
 	}
 
-	deviceModelTmpl, err := processModelTemplates(rctx, getStringSlice(device, "templates"), ctyVars)
+	deviceModelTmpl, err := processModelTemplates(rctx, templateAssignments(device), ctyVars, ProvenanceLevelDevice, "")
 	if err != nil {
 		return nil, fmt.Errorf("device model templates: %w", err)
 	}
 
 	// 4d. 9-level precedence cascade
+	prov := rctx.newProvenanceTracker()
 	merged := make(map[string]any)
 	// 1. Global file templates
 	for _, ft := range globalFileTmpls {
-		MergeMaps(ft, merged, true)
+		prov.merge(merged, ft, ProvenanceLevelGlobal)
 	}
 	// 2. Global model templates
-	MergeMaps(globalModelTmpl, merged, true)
+	prov.merge(merged, globalModelTmpl, ProvenanceLevelGlobal)
 	// 3. Global configuration
-	MergeMaps(deepCopy(getMapVal(rctx.global, "configuration")), merged, true)
+	prov.merge(merged, configLayer{source: "configuration", config: deepCopy(getMapVal(rctx.global, "configuration")).(map[string]any)}, ProvenanceLevelGlobal)
 	// 4. Group file templates
 	for _, ft := range groupFileTmpls {
-		MergeMaps(ft, merged, true)
+		prov.merge(merged, ft, ProvenanceLevelGroup)
 	}
 	// 5. Group model templates
 	for _, mt := range groupModelTmpls {
-		MergeMaps(mt, merged, true)
+		prov.merge(merged, mt, ProvenanceLevelGroup)
 	}
 	// 6. Group configurations
 	for _, gc := range groupConfigs {
-		MergeMaps(deepCopy(gc), merged, true)
+		gc.config = deepCopy(gc.config).(map[string]any)
+		prov.merge(merged, gc, ProvenanceLevelGroup)
 	}
 	// 7. Device file templates
 	for _, ft := range deviceFileTmpls {
-		MergeMaps(ft, merged, true)
+		prov.merge(merged, ft, ProvenanceLevelDevice)
 	}
 	// 8. Device model templates
-	MergeMaps(deviceModelTmpl, merged, true)
+	prov.merge(merged, deviceModelTmpl, ProvenanceLevelDevice)
 	// 9. Device configuration
-	MergeMaps(getMapVal(device, "configuration"), merged, true)
+	prov.merge(merged, configLayer{source: "configuration", config: getMapVal(device, "configuration")}, ProvenanceLevelDevice)
 
 	// 4e. Final template pass
-	merged, err = templatePassOnMap(merged, ctyVars)
+	merged, err = templatePassOnMap(merged, ctyVars, rctx.functions, rctx.limits)
 	if err != nil {
 		return nil, fmt.Errorf("final template pass: %w", err)
 	}
+	prov.refresh(merged)
 
 	// 4e2. Apply defaults as fallbacks
 	if len(rctx.defaultConfig) > 0 {
 		applyDefaults(merged, rctx.defaultConfig)
+		prov.update(merged, func(string) provenanceEntry {
+			return provenanceEntry{Level: ProvenanceLevelDefaults, Source: "defaults", Default: true}
+		})
 	}
 
 	// 4f. Interface groups
@@ -551,7 +755,11 @@ func renderSingleDevice(rctx *renderContext, device map[string]any) (map[string]
 	if err != nil {
 		return nil, fmt.Errorf("interface groups: %w", err)
 	}
-	applyInterfaceGroups(merged, igConfigs)
+	applyInterfaceGroups(merged, igConfigs, rctx.interfaceGroupPriorities)
+	prov.update(merged, interfaceGroupProvenance(merged, igConfigs, rctx.interfaceGroupPriorities))
+	if prov != nil {
+		rctx.provenance[deviceName] = prov.result()
+	}
 
 	// 4g. CLI templates
 	cliTemplates, err := collectCliTemplates(rctx, device, deviceVars, ctyVars)
@@ -582,12 +790,8 @@ func buildDeviceVariables(rctx *renderContext, device map[string]any) map[string
 	}
 	// Global variables
 	mergeShallowInto(result, getMapVal(rctx.global, "variables"))
-	// Device group variables (in order)
-	for _, dgRaw := range rctx.deviceGroups {
-		dg, ok := dgRaw.(map[string]any)
-		if !ok || !deviceMatchesGroup(device, dg) {
-			continue
-		}
+	// Device group variables (ancestors before descendants)
+	for _, dg := range rctx.matchingDeviceGroups(device) {
 		mergeShallowInto(result, getMapVal(dg, "variables"))
 	}
 	// Device variables
@@ -595,19 +799,20 @@ func buildDeviceVariables(rctx *renderContext, device map[string]any) map[string
 	return result
 }
 
-func processFileTemplates(rctx *renderContext, templateNames []string, vars map[string]cty.Value) ([]map[string]any, error) {
-	var results []map[string]any
+func processFileTemplates(rctx *renderContext, assignments []templateAssignment, vars map[string]cty.Value) ([]configLayer, error) {
+	templateNames, err := rctx.selectTemplates(assignments, "file", vars)
+	if err != nil {
+		return nil, err
+	}
+	var results []configLayer
 	for _, name := range templateNames {
-		tmpl, ok := rctx.templates[name]
-		if !ok || getStringVal(tmpl, "type", "") != "file" {
-			continue
-		}
+		tmpl := rctx.templates[name]
 		filePath := getStringVal(tmpl, "file", "")
 		content, ok := rctx.fileTemplates[filePath]
 		if !ok {
 			return nil, fmt.Errorf("file template %q (path %q) not found in file_templates parameter", name, filePath)
 		}
-		rendered, err := renderHCLTemplate(content, vars)
+		rendered, err := rctx.renderTemplate(name, content, vars)
 		if err != nil {
 			return nil, fmt.Errorf("rendering file template %q: %w", name, err)
 		}
@@ -616,42 +821,51 @@ func processFileTemplates(rctx *renderContext, templateNames []string, vars map[
 			return nil, fmt.Errorf("decoding file template %q: %w", name, err)
 		}
 		if m, ok := normalizeToMapStringAny(decoded); ok {
-			results = append(results, m)
+			results = append(results, configLayer{source: name, config: m})
 		}
 	}
 	return results, nil
 }
 
-func processModelTemplates(rctx *renderContext, templateNames []string, vars map[string]cty.Value) (map[string]any, error) {
+// processModelTemplates renders the model templates of one level of the cascade
+// and merges them into a single layer. group is the device group name for the
+// group level, which is added to the template names in the provenance.
+func processModelTemplates(rctx *renderContext, assignments []templateAssignment, vars map[string]cty.Value, level, group string) (configLayer, error) {
+	templateNames, err := rctx.selectTemplates(assignments, "model", vars)
+	if err != nil {
+		return configLayer{}, err
+	}
 	merged := make(map[string]any)
+	sources := rctx.newProvenanceTracker()
 	for _, name := range templateNames {
-		tmpl, ok := rctx.templates[name]
-		if !ok || getStringVal(tmpl, "type", "") != "model" {
-			continue
-		}
+		tmpl := rctx.templates[name]
 		config := getMapVal(tmpl, "configuration")
 		if len(config) == 0 {
 			continue
 		}
-		rendered, err := renderTemplateValues(config, vars)
+		rendered, err := renderTemplateValues(config, vars, rctx.functions, rctx.limits)
 		if err != nil {
-			return nil, fmt.Errorf("rendering model template %q: %w", name, err)
+			return configLayer{}, fmt.Errorf("rendering model template %q: %w", name, err)
 		}
 		if m, ok := rendered.(map[string]any); ok {
-			MergeMaps(m, merged, true)
+			source := name
+			if group != "" {
+				source = fmt.Sprintf("%s/%s", name, group)
+			}
+			sources.merge(merged, configLayer{source: source, config: m}, level)
 		}
 	}
-	return merged, nil
+	return configLayer{config: merged, sources: sources}, nil
 }
 
 // renderTemplateValues walks a native value tree and renders HCL template
 // expressions in string values. Non-string values are returned unchanged.
-func renderTemplateValues(v any, vars map[string]cty.Value) (any, error) {
+func renderTemplateValues(v any, vars map[string]cty.Value, funcs map[string]ctyfunction.Function, limits *templateLimits) (any, error) {
 	switch val := v.(type) {
 	case map[string]any:
 		result := make(map[string]any, len(val))
 		for k, item := range val {
-			rendered, err := renderTemplateValues(item, vars)
+			rendered, err := renderTemplateValues(item, vars, funcs, limits)
 			if err != nil {
 				return nil, err
 			}
@@ -661,7 +875,7 @@ func renderTemplateValues(v any, vars map[string]cty.Value) (any, error) {
 	case []any:
 		result := make([]any, len(val))
 		for i, item := range val {
-			rendered, err := renderTemplateValues(item, vars)
+			rendered, err := renderTemplateValues(item, vars, funcs, limits)
 			if err != nil {
 				return nil, err
 			}
@@ -672,17 +886,18 @@ func renderTemplateValues(v any, vars map[string]cty.Value) (any, error) {
 		if !strings.Contains(val, "${") {
 			return val, nil
 		}
-		return renderHCLTemplateValue(val, vars)
+		limits.begin()
+		return renderHCLTemplateValueWithFunctions(val, vars, funcs, limits)
 	default:
 		return v, nil
 	}
 }
 
-func templatePassOnMap(m map[string]any, vars map[string]cty.Value) (map[string]any, error) {
+func templatePassOnMap(m map[string]any, vars map[string]cty.Value, funcs map[string]ctyfunction.Function, limits *templateLimits) (map[string]any, error) {
 	if len(m) == 0 {
 		return m, nil
 	}
-	rendered, err := renderTemplateValues(m, vars)
+	rendered, err := renderTemplateValues(m, vars, funcs, limits)
 	if err != nil {
 		return nil, err
 	}
@@ -703,12 +918,19 @@ func resolveInterfaceGroupConfigs(rctx *renderContext, vars map[string]cty.Value
 		if name == "" {
 			continue
 		}
+		ok, err := evaluateWhen(ig["when"], vars, rctx.functions, rctx.limits)
+		if err != nil {
+			return nil, fmt.Errorf("interface group %q: %w", name, err)
+		}
+		if !ok {
+			continue
+		}
 		config := getMapVal(ig, "configuration")
 		if len(config) == 0 {
 			igConfigs[name] = map[string]any{}
 			continue
 		}
-		rendered, err := renderTemplateValues(config, vars)
+		rendered, err := renderTemplateValues(config, vars, rctx.functions, rctx.limits)
 		if err != nil {
 			return nil, fmt.Errorf("interface group %q: %w", name, err)
 		}
@@ -719,7 +941,7 @@ func resolveInterfaceGroupConfigs(rctx *renderContext, vars map[string]cty.Value
 	return igConfigs, nil
 }
 
-func applyInterfaceGroups(config map[string]any, igConfigs map[string]map[string]any) {
+func applyInterfaceGroups(config map[string]any, igConfigs map[string]map[string]any, priorities map[string]int) {
 	interfaces := getMapVal(config, "interfaces")
 	if len(interfaces) == 0 || len(igConfigs) == 0 {
 		return
@@ -742,12 +964,12 @@ func applyInterfaceGroups(config map[string]any, igConfigs map[string]map[string
 						if subMap == nil {
 							continue
 						}
-						subs[j] = applyInterfaceGroupToItem(subMap, igConfigs)
+						subs[j] = applyInterfaceGroupToItem(subMap, igConfigs, priorities)
 					}
 					itemMap["subinterfaces"] = subs
 				}
 			}
-			items[i] = applyInterfaceGroupToItem(itemMap, igConfigs)
+			items[i] = applyInterfaceGroupToItem(itemMap, igConfigs, priorities)
 		}
 		interfaces[typeName] = items
 	}
@@ -769,13 +991,13 @@ func toMapStringAny(v any) map[string]any {
 	return nil
 }
 
-func applyInterfaceGroupToItem(item map[string]any, igConfigs map[string]map[string]any) map[string]any {
+func applyInterfaceGroupToItem(item map[string]any, igConfigs map[string]map[string]any, priorities map[string]int) map[string]any {
 	groups := getStringSlice(item, "interface_groups")
 	if len(groups) == 0 {
 		return item
 	}
 	merged := make(map[string]any)
-	for _, g := range groups {
+	for _, g := range orderInterfaceGroups(groups, priorities) {
 		if cfg, ok := igConfigs[g]; ok {
 			MergeMaps(deepCopy(cfg), merged, true)
 		}
@@ -833,16 +1055,17 @@ func collectCliTemplates(rctx *renderContext, device map[string]any, deviceVars
 	var result []any
 
 	// Global CLI templates
-	for _, name := range getStringSlice(rctx.global, "templates") {
-		tmpl, ok := rctx.templates[name]
-		if !ok || getStringVal(tmpl, "type", "") != "cli" {
-			continue
-		}
+	names, err := rctx.selectTemplates(templateAssignments(rctx.global), "cli", ctyVars)
+	if err != nil {
+		return nil, fmt.Errorf("global cli templates: %w", err)
+	}
+	for _, name := range names {
+		tmpl := rctx.templates[name]
 		content := getStringVal(tmpl, "content", "")
 		if content == "" {
 			continue
 		}
-		rendered, err := renderHCLTemplate(content, ctyVars)
+		rendered, err := rctx.renderTemplate(name, content, ctyVars)
 		if err != nil {
 			return nil, fmt.Errorf("global cli template %q: %w", name, err)
 		}
@@ -854,27 +1077,24 @@ func collectCliTemplates(rctx *renderContext, device map[string]any, deviceVars
 	}
 
 	// Group CLI templates
-	for _, dgRaw := range rctx.deviceGroups {
-		dg, ok := dgRaw.(map[string]any)
-		if !ok || !deviceMatchesGroup(device, dg) {
-			continue
-		}
+	for _, dg := range rctx.matchingDeviceGroups(device) {
 		dgName := getStringVal(dg, "name", "")
 		groupVars := mergeShallow(deviceVars, getMapVal(dg, "variables"))
 		groupCtyVars, err := nativeToCtyMap(groupVars)
 		if err != nil {
 			return nil, fmt.Errorf("group %q cli vars: %w", dgName, err)
 		}
-		for _, name := range getStringSlice(dg, "templates") {
-			tmpl, ok := rctx.templates[name]
-			if !ok || getStringVal(tmpl, "type", "") != "cli" {
-				continue
-			}
+		names, err := rctx.selectTemplates(templateAssignments(dg), "cli", groupCtyVars)
+		if err != nil {
+			return nil, fmt.Errorf("group %q cli templates: %w", dgName, err)
+		}
+		for _, name := range names {
+			tmpl := rctx.templates[name]
 			content := getStringVal(tmpl, "content", "")
 			if content == "" {
 				continue
 			}
-			rendered, err := renderHCLTemplate(content, groupCtyVars)
+			rendered, err := rctx.renderTemplate(name, content, groupCtyVars)
 			if err != nil {
 				return nil, fmt.Errorf("group %q cli template %q: %w", dgName, name, err)
 			}
@@ -887,16 +1107,17 @@ func collectCliTemplates(rctx *renderContext, device map[string]any, deviceVars
 	}
 
 	// Device CLI templates
-	for _, name := range getStringSlice(device, "templates") {
-		tmpl, ok := rctx.templates[name]
-		if !ok || getStringVal(tmpl, "type", "") != "cli" {
-			continue
-		}
+	names, err = rctx.selectTemplates(templateAssignments(device), "cli", ctyVars)
+	if err != nil {
+		return nil, fmt.Errorf("device cli templates: %w", err)
+	}
+	for _, name := range names {
+		tmpl := rctx.templates[name]
 		content := getStringVal(tmpl, "content", "")
 		if content == "" {
 			continue
 		}
-		rendered, err := renderHCLTemplate(content, ctyVars)
+		rendered, err := rctx.renderTemplate(name, content, ctyVars)
 		if err != nil {
 			return nil, fmt.Errorf("device cli template %q: %w", name, err)
 		}
@@ -968,7 +1189,7 @@ func stripNulls(v any) any {
 	}
 }
 
-// buildProviderDevices extracts name/managed and connection fields (url/host/protocol)
+// buildProviderDevices extracts name/managed/architecture and connection fields (url/host/protocol)
 // from all devices for provider configuration.
 func buildProviderDevices(model map[string]any, arch string, defaultManaged bool) []any {
 	archConfig := getMapVal(model, arch)
@@ -980,8 +1201,9 @@ func buildProviderDevices(model map[string]any, arch string, defaultManaged bool
 			continue
 		}
 		pd := map[string]any{
-			"name":    getStringVal(dm, "name", ""),
-			"managed": getBoolVal(dm, "managed", defaultManaged),
+			"name":         getStringVal(dm, "name", ""),
+			"managed":      getBoolVal(dm, "managed", defaultManaged),
+			"architecture": arch,
 		}
 		// Copy optional connection fields (omit if not present)
 		for _, field := range []string{"url", "host", "protocol"} {
@@ -994,6 +1216,94 @@ func buildProviderDevices(model map[string]any, arch string, defaultManaged bool
 	return result
 }
 
+// mergeSopsPaths merges src into dst and updates sopsPaths, the paths in dst of
+// the values decrypted from SOPS documents, with the paths of the decrypted values
+// of src. Values set again by src are no longer considered decrypted.
+func mergeSopsPaths(src, dst any, paths []string, sopsPaths map[string]bool) {
+	trace := newMergeTrace()
+	mergeMapsTraced(src, dst, true, trace, "", "")
+	for leaf := range configLeaves(src) {
+		delete(sopsPaths, trace.destination(leaf))
+	}
+	for _, path := range paths {
+		sopsPaths[trace.destination(path)] = true
+	}
+}
+
+// sopsResultPaths maps the paths of the values decrypted from SOPS documents in the
+// merged model to the configuration paths of the rendered devices in result. A value
+// below a device's "configuration" is mapped to the same path of that device, one
+// below any other "configuration" key (global, device group, template or defaults)
+// to the same path of every device and one of an interface group to the interfaces
+// and subinterfaces of every device. List indices are matched as wildcards, as list
+// items are merged across levels, so a path may be listed although the value was
+// overridden. Values reaching the configuration through variables are not mapped.
+func sopsResultPaths(model map[string]any, sopsPaths map[string]bool, result map[string]any) []string {
+	type sopsPattern struct {
+		device string // name of the device the value belongs to, or "" for all devices
+		path   string // configuration path with list indices replaced by "[*]"
+		iface  bool   // path is relative to an interface
+	}
+	patterns := map[string][]sopsPattern{}
+	for path := range sopsPaths {
+		prefix, rest, ok := strings.Cut(path, ".configuration.")
+		if !ok {
+			continue
+		}
+		keys := strings.Split(prefix, ".")
+		if keys[0] == "defaults" {
+			keys = keys[1:]
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		arch := keys[0]
+		pattern := sopsPattern{path: listIndexRegexp.ReplaceAllString(rest, "[*]")}
+		if len(keys) == 2 {
+			switch {
+			case strings.HasPrefix(keys[1], "devices["):
+				segments, err := parseRefPath(prefix + ".name")
+				if err != nil {
+					continue
+				}
+				name, _ := lookupRefPath(model, segments)
+				pattern.device, _ = name.(string)
+			case strings.HasPrefix(keys[1], "interface_groups["):
+				pattern.iface = true
+			}
+		}
+		patterns[arch] = append(patterns[arch], pattern)
+	}
+
+	var paths []string
+	for arch, archPatterns := range patterns {
+		for i, d := range getSliceVal(getMapVal(result, arch), "devices") {
+			device := toMapStringAny(d)
+			name := getStringVal(device, "name", "")
+			for leaf := range configLeaves(device["configuration"]) {
+				wildcard := listIndexRegexp.ReplaceAllString(leaf, "[*]")
+				for _, p := range archPatterns {
+					if p.device != "" && p.device != name {
+						continue
+					}
+					if wildcard == p.path || p.iface && strings.HasPrefix(wildcard, "interfaces.") && strings.HasSuffix(wildcard, "]."+p.path) {
+						paths = append(paths, appendKeyPath(appendIndexPath(arch+".devices", i), "configuration")+"."+leaf)
+						break
+					}
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// sortedUnion returns the sorted, deduplicated paths of a and b.
+func sortedUnion(a, b []string) []string {
+	paths := append(append([]string{}, a...), b...)
+	sort.Strings(paths)
+	return slices.Compact(paths)
+}
+
 // --- Helper functions ---
 
 func nativeToCtyMap(m map[string]any) (map[string]cty.Value, error) {
@@ -18,6 +18,10 @@
 package provider
 
 import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
@@ -272,6 +276,81 @@ func testAccRenderDeviceConfigs_modelTemplates() string {
 	`
 }
 
+func TestRenderDeviceConfigsFunction_ModelTemplatesStructured(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_modelTemplatesStructured(),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("ntp_servers", "10.0.0.1,10.0.0.2"),
+					resource.TestCheckOutput("vrfs", "BLUE,RED"),
+					resource.TestCheckOutput("snmp_location", "dc1"),
+					resource.TestCheckOutput("vlan_count", "2"),
+				),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_modelTemplatesStructured() string {
+	return `
+	locals {
+		model = {
+			nxos = {
+				ntp_servers = ["10.0.0.1", "10.0.0.2"]
+				templates = [
+					{
+						name = "base"
+						type = "model"
+						configuration = {
+							ntp_servers = "$${GLOBAL.ntp_servers}"
+							vrfs        = "$${[for v in vrf_names : { name = upper(v) }]}"
+							snmp        = "$${snmp}"
+							vlans       = "$${normalize_vlans({ ids = [10, 20] }, \"list\")}"
+						}
+					}
+				]
+				global = {
+					templates = ["base"]
+					variables = {
+						vrf_names = ["blue", "red"]
+						snmp = {
+							location = "dc1"
+						}
+					}
+				}
+				devices = [
+					{
+						name          = "spine1"
+						configuration = {}
+					}
+				]
+			}
+		}
+
+		result = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+		config = local.result.raw.nxos.devices[0].configuration
+	}
+
+	output "ntp_servers" {
+		value = join(",", local.config.ntp_servers)
+	}
+	output "vrfs" {
+		value = join(",", [for v in local.config.vrfs : v.name])
+	}
+	output "snmp_location" {
+		value = local.config.snmp.location
+	}
+	output "vlan_count" {
+		value = tostring(length(local.config.vlans))
+	}
+	`
+}
+
 func TestRenderDeviceConfigsFunction_DeviceFilter(t *testing.T) {
 	resource.UnitTest(t, resource.TestCase{
 		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
@@ -380,6 +459,147 @@ func testAccRenderDeviceConfigs_groupFilter() string {
 	`
 }
 
+func TestRenderDeviceConfigsFunction_ManagedSelectors(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_managedSelectors(`["site=dc1", "!spine*"]`, `[]`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("device_names", "leaf1"),
+				),
+			},
+			{
+				Config: testAccRenderDeviceConfigs_managedSelectors(`["/(leaf|spine)1/"]`, `["!border*"]`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("device_names", "spine1,leaf1"),
+				),
+			},
+			{
+				Config:      testAccRenderDeviceConfigs_managedSelectors(`["site=dc1,role"]`, `[]`),
+				ExpectError: regexp.MustCompile(`managed_devices:\s+invalid\s+label\s+selector`),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_managedSelectors(managedDevices, managedGroups string) string {
+	return `
+	locals {
+		model = {
+			nxos = {
+				device_groups = [
+					{
+						name    = "border_leafs"
+						devices = ["leaf2"]
+					}
+				]
+				devices = [
+					{
+						name   = "spine1"
+						labels = { site = "dc1" }
+					},
+					{
+						name   = "leaf1"
+						labels = { site = "dc1" }
+					},
+					{
+						name   = "leaf2"
+						labels = { site = "dc2" }
+					}
+				]
+			}
+		}
+
+		result = provider::utils::render_device_configs([], local.model, "", {}, ` + managedDevices + `, ` + managedGroups + `)
+	}
+
+	output "device_names" {
+		value = join(",", [for d in local.result.raw.nxos.devices : d.name])
+	}
+	`
+}
+
+func TestRenderDeviceConfigsFunction_Schemas(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_schemas(`ethernets`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("device_count", "2"),
+				),
+			},
+			{
+				// Both devices are reported, with their configuration paths
+				Config:      testAccRenderDeviceConfigs_schemas(`ethernet`),
+				ExpectError: regexp.MustCompile(`(?s)2\s+schema\s+validation\s+error\(s\).*"leaf1":\s+interfaces:\s+additional\s+properties\s+'ethernet'.*"leaf2":\s+interfaces:`),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_schemas(interfaceKey string) string {
+	return `
+	locals {
+		model = {
+			nxos = {
+				global = {
+					configuration = {
+						interfaces = {
+							` + interfaceKey + ` = [
+								{
+									name = "Ethernet1/1"
+								}
+							]
+						}
+					}
+				}
+				devices = [
+					{
+						name = "leaf1"
+					},
+					{
+						name = "leaf2"
+					}
+				]
+			}
+		}
+
+		schema = {
+			type = "object"
+			properties = {
+				interfaces = {
+					type                 = "object"
+					additionalProperties = false
+					properties = {
+						ethernets = {
+							type = "array"
+						}
+					}
+				}
+			}
+		}
+
+		result = provider::utils::render_device_configs([], local.model, "", {}, [], [], {
+			schemas = {
+				nxos = jsonencode(local.schema)
+			}
+		})
+	}
+
+	output "device_count" {
+		value = tostring(length(local.result.raw.nxos.devices))
+	}
+	`
+}
+
 func TestRenderDeviceConfigsFunction_InterfaceGroups(t *testing.T) {
 	resource.UnitTest(t, resource.TestCase{
 		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
@@ -989,7 +1209,7 @@ func testAccRenderDeviceConfigs_bidirectionalGroups() string {
 	`
 }
 
-func TestRenderDeviceConfigsFunction_Defaults(t *testing.T) {
+func TestRenderDeviceConfigsFunction_NestedGroups(t *testing.T) {
 	resource.UnitTest(t, resource.TestCase{
 		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
 			tfversion.SkipBelow(tfversion.Version1_8_0),
@@ -997,86 +1217,118 @@ func TestRenderDeviceConfigsFunction_Defaults(t *testing.T) {
 		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccRenderDeviceConfigs_defaults(),
+				Config: testAccRenderDeviceConfigs_nestedGroups(`[]`),
 				Check: resource.ComposeAggregateTestCheckFunc(
-					// Device overrides default
-					resource.TestCheckOutput("feature_bgp", "true"),
-					// Default applied (not in device config)
-					resource.TestCheckOutput("feature_ospf", "false"),
-					// List-item default applied to VRF
-					resource.TestCheckOutput("vrf_description", "default-desc"),
-					// VRF name preserved (not overridden by defaults)
-					resource.TestCheckOutput("vrf_name", "vrf1"),
-					// Default managed from defaults parameter
-					resource.TestCheckOutput("device_managed", "true"),
+					resource.TestCheckOutput("device_count", "2"),
+					// Inherited from the grandparent group
+					resource.TestCheckOutput("leaf1_domain", "example.com"),
+					// Parent overrides grandparent
+					resource.TestCheckOutput("leaf1_mtu", "9216"),
+					// Child variable overrides parent variable in templates
+					resource.TestCheckOutput("leaf1_hostname", "border-leaf1"),
+					resource.TestCheckOutput("spine1_mtu", "1500"),
+				),
+			},
+			{
+				// Matching an ancestor group selects the devices of its descendants
+				Config: testAccRenderDeviceConfigs_nestedGroups(`["leafs"]`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("device_count", "1"),
+					resource.TestCheckOutput("leaf1_mtu", "9216"),
 				),
 			},
 		},
 	})
 }
 
-func testAccRenderDeviceConfigs_defaults() string {
+func testAccRenderDeviceConfigs_nestedGroups(managedGroups string) string {
 	return `
 	locals {
 		model = {
 			nxos = {
-				devices = [
+				templates = [
 					{
-						name = "spine1"
-						url  = "https://spine1.example.com"
+						name = "hostname"
+						type = "model"
 						configuration = {
-							feature = {
-								bgp = true
+							system = {
+								hostname = "$${role}-$${device_name}"
+							}
+						}
+					}
+				]
+				device_groups = [
+					{
+						name          = "border"
+						parent_groups = ["leafs"]
+						devices       = ["leaf1"]
+						templates     = ["hostname"]
+						variables = {
+							role = "border"
+						}
+					},
+					{
+						name          = "leafs"
+						parent_groups = ["fabric"]
+						variables = {
+							role = "leaf"
+						}
+						configuration = {
+							system = {
+								mtu = 9216
+							}
+						}
+					},
+					{
+						name = "fabric"
+						configuration = {
+							system = {
+								domain = "example.com"
+								mtu    = 1500
 							}
-							vrfs = [
-								{
-									name = "vrf1"
-								}
-							]
 						}
 					}
 				]
+				devices = [
+					{
+						name = "leaf1"
+						variables = {
+							device_name = "leaf1"
+						}
+						configuration = {}
+					},
+					{
+						name          = "spine1"
+						device_groups = ["fabric"]
+						configuration = {}
+					}
+				]
 			}
 		}
 
-		defaults_yaml = <<-EOT
-defaults:
-  nxos:
-    devices:
-      managed: true
-      configuration:
-        feature:
-          bgp: false
-          ospf: false
-        vrfs:
-          description: default-desc
-    templates:
-      order: 0
-EOT
-
-		result = provider::utils::render_device_configs([], local.model, local.defaults_yaml, {}, [], [])
-		device = local.result.raw.nxos.devices[0]
+		result = provider::utils::render_device_configs([], local.model, "", {}, [], ` + managedGroups + `)
+		devices = { for d in local.result.raw.nxos.devices : d.name => d }
 	}
 
-	output "feature_bgp" {
-		value = tostring(local.device.configuration.feature.bgp)
+	output "device_count" {
+		value = tostring(length(local.devices))
 	}
-	output "feature_ospf" {
-		value = tostring(local.device.configuration.feature.ospf)
+	output "leaf1_domain" {
+		value = local.devices["leaf1"].configuration.system.domain
 	}
-	output "vrf_description" {
-		value = local.device.configuration.vrfs[0].description
+	output "leaf1_mtu" {
+		value = tostring(local.devices["leaf1"].configuration.system.mtu)
 	}
-	output "vrf_name" {
-		value = local.device.configuration.vrfs[0].name
+	output "leaf1_hostname" {
+		value = local.devices["leaf1"].configuration.system.hostname
 	}
-	output "device_managed" {
-		value = tostring(local.device.managed)
+	output "spine1_mtu" {
+		value = try(tostring(local.devices["spine1"].configuration.system.mtu), "")
 	}
 	`
 }
 
-func TestRenderDeviceConfigsFunction_YamlMerge(t *testing.T) {
+func TestRenderDeviceConfigsFunction_GroupPriority(t *testing.T) {
 	resource.UnitTest(t, resource.TestCase{
 		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
 			tfversion.SkipBelow(tfversion.Version1_8_0),
@@ -1084,45 +1336,972 @@ func TestRenderDeviceConfigsFunction_YamlMerge(t *testing.T) {
 		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccRenderDeviceConfigs_yamlMerge(),
+				Config: testAccRenderDeviceConfigs_groupPriority(),
 				Check: resource.ComposeAggregateTestCheckFunc(
-					resource.TestCheckOutput("hostname", "spine1"),
-					resource.TestCheckOutput("dns_server", "10.0.0.53"),
+					// "site" has the higher priority although listed first
+					resource.TestCheckOutput("mtu", "9000"),
+					resource.TestCheckOutput("role_var", "site"),
+					// "fabric" has the higher priority although referenced first
+					resource.TestCheckOutput("eth_mtu", "9216"),
+					resource.TestCheckOutput("eth_description", "access"),
 				),
 			},
 		},
 	})
 }
 
-func testAccRenderDeviceConfigs_yamlMerge() string {
+func testAccRenderDeviceConfigs_groupPriority() string {
 	return `
 	locals {
-		yaml1 = <<-EOT
-nxos:
-  global:
-    configuration:
-      system:
-        dns_server: "10.0.0.53"
-  devices:
-    - name: spine1
-      configuration:
-        system:
+		model = {
+			nxos = {
+				templates = [
+					{
+						name = "role"
+						type = "model"
+						configuration = {
+							system = {
+								role = "$${role}"
+							}
+						}
+					}
+				]
+				device_groups = [
+					{
+						name     = "site"
+						priority = 20
+						variables = {
+							role = "site"
+						}
+						configuration = {
+							system = {
+								mtu = 9000
+							}
+						}
+					},
+					{
+						name     = "leafs"
+						priority = 10
+						variables = {
+							role = "leaf"
+						}
+						configuration = {
+							system = {
+								mtu = 1500
+							}
+						}
+					}
+				]
+				interface_groups = [
+					{
+						name     = "fabric"
+						priority = 10
+						configuration = {
+							mtu = 9216
+						}
+					},
+					{
+						name = "access"
+						configuration = {
+							mtu         = 1500
+							description = "access"
+						}
+					}
+				]
+				devices = [
+					{
+						name          = "leaf1"
+						device_groups = ["site", "leafs"]
+						templates     = ["role"]
+						configuration = {
+							interfaces = {
+								ethernets = [
+									{
+										name             = "Ethernet1/1"
+										interface_groups = ["fabric", "access"]
+									}
+								]
+							}
+						}
+					}
+				]
+			}
+		}
+
+		result = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+		device = local.result.raw.nxos.devices[0]
+		eth    = local.device.configuration.interfaces.ethernets[0]
+	}
+
+	output "mtu" {
+		value = tostring(local.device.configuration.system.mtu)
+	}
+	output "role_var" {
+		value = local.device.configuration.system.role
+	}
+	output "eth_mtu" {
+		value = tostring(local.eth.mtu)
+	}
+	output "eth_description" {
+		value = local.eth.description
+	}
+	`
+}
+
+func TestRenderDeviceConfigsFunction_When(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_when(),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					// Template condition
+					resource.TestCheckOutput("leaf1_vpc", "true"),
+					resource.TestCheckOutput("spine1_vpc", "absent"),
+					// Group assignment condition
+					resource.TestCheckOutput("leaf1_cli_count", "1"),
+					resource.TestCheckOutput("spine1_cli_count", "0"),
+					// Interface group condition
+					resource.TestCheckOutput("leaf1_eth_mtu", "9216"),
+					resource.TestCheckOutput("spine1_eth_mtu", "absent"),
+				),
+			},
+			{
+				Config: `
+				locals {
+					model = {
+						nxos = {
+							templates = [
+								{ name = "t", type = "model", when = "role", configuration = {} }
+							]
+							devices = [{ name = "leaf1", templates = ["t"], variables = { role = "leaf" } }]
+						}
+					}
+					result = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+				}
+				output "result" {
+					value = local.result.raw
+				}
+				`,
+				ExpectError: regexp.MustCompile(`must\s+evaluate\s+to\s+a\s+boolean`),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_when() string {
+	return `
+	locals {
+		model = {
+			nxos = {
+				templates = [
+					{
+						name = "vpc"
+						type = "model"
+						when = "role == \"leaf\" && startswith(version, \"10.\")"
+						configuration = {
+							features = {
+								vpc = true
+							}
+						}
+					},
+					{
+						name    = "banner"
+						type    = "cli"
+						content = "banner motd #$${role}#"
+					}
+				]
+				device_groups = [
+					{
+						name    = "all"
+						devices = ["leaf1", "spine1"]
+						templates = [
+							"vpc",
+							{
+								name = "banner"
+								when = "role == \"leaf\""
+							}
+						]
+					}
+				]
+				interface_groups = [
+					{
+						name = "fabric"
+						when = "role == \"leaf\""
+						configuration = {
+							mtu = 9216
+						}
+					}
+				]
+				devices = [
+					{
+						name = "leaf1"
+						variables = {
+							role    = "leaf"
+							version = "10.3(2)"
+						}
+						configuration = {
+							interfaces = {
+								ethernets = [
+									{
+										name             = "Ethernet1/1"
+										interface_groups = ["fabric"]
+									}
+								]
+							}
+						}
+					},
+					{
+						name = "spine1"
+						variables = {
+							role    = "spine"
+							version = "10.3(2)"
+						}
+						configuration = {
+							interfaces = {
+								ethernets = [
+									{
+										name             = "Ethernet1/1"
+										interface_groups = ["fabric"]
+									}
+								]
+							}
+						}
+					}
+				]
+			}
+		}
+
+		result  = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+		devices = { for d in local.result.raw.nxos.devices : d.name => d }
+	}
+
+	output "leaf1_vpc" {
+		value = try(tostring(local.devices["leaf1"].configuration.features.vpc), "absent")
+	}
+	output "spine1_vpc" {
+		value = try(tostring(local.devices["spine1"].configuration.features.vpc), "absent")
+	}
+	output "leaf1_cli_count" {
+		value = tostring(length(local.devices["leaf1"].cli_templates))
+	}
+	output "spine1_cli_count" {
+		value = tostring(length(local.devices["spine1"].cli_templates))
+	}
+	output "leaf1_eth_mtu" {
+		value = try(tostring(local.devices["leaf1"].configuration.interfaces.ethernets[0].mtu), "absent")
+	}
+	output "spine1_eth_mtu" {
+		value = try(tostring(local.devices["spine1"].configuration.interfaces.ethernets[0].mtu), "absent")
+	}
+	`
+}
+
+func TestRenderDeviceConfigsFunction_NestedGroupsCycle(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					model = {
+						nxos = {
+							device_groups = [
+								{ name = "a", parent_groups = ["b"] },
+								{ name = "b", parent_groups = ["a"] }
+							]
+							devices = [{ name = "leaf1", device_groups = ["a"] }]
+						}
+					}
+					result = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+				}
+				output "result" {
+					value = local.result.raw
+				}
+				`,
+				ExpectError: regexp.MustCompile(`device\s+group\s+cycle\s+detected`),
+			},
+		},
+	})
+}
+
+func TestRenderDeviceConfigsFunction_Defaults(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_defaults(),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					// Device overrides default
+					resource.TestCheckOutput("feature_bgp", "true"),
+					// Default applied (not in device config)
+					resource.TestCheckOutput("feature_ospf", "false"),
+					// List-item default applied to VRF
+					resource.TestCheckOutput("vrf_description", "default-desc"),
+					// VRF name preserved (not overridden by defaults)
+					resource.TestCheckOutput("vrf_name", "vrf1"),
+					// Default managed from defaults parameter
+					resource.TestCheckOutput("device_managed", "true"),
+				),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_defaults() string {
+	return `
+	locals {
+		model = {
+			nxos = {
+				devices = [
+					{
+						name = "spine1"
+						url  = "https://spine1.example.com"
+						configuration = {
+							feature = {
+								bgp = true
+							}
+							vrfs = [
+								{
+									name = "vrf1"
+								}
+							]
+						}
+					}
+				]
+			}
+		}
+
+		defaults_yaml = <<-EOT
+defaults:
+  nxos:
+    devices:
+      managed: true
+      configuration:
+        feature:
+          bgp: false
+          ospf: false
+        vrfs:
+          description: default-desc
+    templates:
+      order: 0
+EOT
+
+		result = provider::utils::render_device_configs([], local.model, local.defaults_yaml, {}, [], [])
+		device = local.result.raw.nxos.devices[0]
+	}
+
+	output "feature_bgp" {
+		value = tostring(local.device.configuration.feature.bgp)
+	}
+	output "feature_ospf" {
+		value = tostring(local.device.configuration.feature.ospf)
+	}
+	output "vrf_description" {
+		value = local.device.configuration.vrfs[0].description
+	}
+	output "vrf_name" {
+		value = local.device.configuration.vrfs[0].name
+	}
+	output "device_managed" {
+		value = tostring(local.device.managed)
+	}
+	`
+}
+
+func TestRenderDeviceConfigsFunction_YamlMerge(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_yamlMerge(),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("hostname", "spine1"),
+					resource.TestCheckOutput("dns_server", "10.0.0.53"),
+				),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_yamlMerge() string {
+	return `
+	locals {
+		yaml1 = <<-EOT
+nxos:
+  global:
+    configuration:
+      system:
+        dns_server: "10.0.0.53"
+  devices:
+    - name: spine1
+      configuration:
+        system:
           hostname: spine1
 EOT
 
-		result = provider::utils::render_device_configs([local.yaml1], {}, "", {}, [], [])
+		result = provider::utils::render_device_configs([local.yaml1], {}, "", {}, [], [])
+		device = local.result.raw.nxos.devices[0]
+	}
+
+	output "hostname" {
+		value = local.device.configuration.system.hostname
+	}
+	output "dns_server" {
+		value = local.device.configuration.system.dns_server
+	}
+	`
+}
+
+func TestRenderDeviceConfigsFunction_YamlRefs(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_yamlRefs(),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("hostname", "spine1"),
+					resource.TestCheckOutput("ntp_server", "10.0.0.99"),
+				),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_yamlRefs() string {
+	return `
+	locals {
+		yaml1 = <<-EOT
+nxos:
+  global:
+    variables:
+      ntp_server: 10.0.0.1
+  devices:
+    - name: spine1
+      configuration:
+        system:
+          hostname: !ref nxos.devices[name=spine1].name
+        ntp:
+          server: !ref nxos.global.variables.ntp_server
+EOT
+
+		model = {
+			nxos = {
+				global = {
+					variables = {
+						ntp_server = "10.0.0.99"
+					}
+				}
+			}
+		}
+
+		result = provider::utils::render_device_configs([local.yaml1], local.model, "", {}, [], [])
+		device = local.result.raw.nxos.devices[0]
+	}
+
+	output "hostname" {
+		value = local.device.configuration.system.hostname
+	}
+	output "ntp_server" {
+		value = local.device.configuration.ntp.server
+	}
+	`
+}
+
+func TestRenderDeviceConfigsFunction_Includes(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_includes(),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("cli_content", "hostname spine1\nntp server 10.0.0.9\nlogging server 10.0.0.1"),
+					resource.TestCheckOutput("file_description", "spine1 managed by terraform"),
+				),
+			},
+			{
+				Config: `
+				locals {
+					model = {
+						nxos = {
+							templates = [
+								{ name = "a", type = "cli", content = "$${include(\"b\")}" },
+								{ name = "b", type = "cli", content = "$${include(\"a\")}" },
+							]
+							global  = { templates = ["a"] }
+							devices = [{ name = "spine1", configuration = {} }]
+						}
+					}
+				}
+				output "test" {
+					value = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+				}
+				`,
+				ExpectError: regexp.MustCompile(`include\s+cycle:\s+a\s+->\s+b\s+->\s+a`),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_includes() string {
+	return `
+	locals {
+		model = {
+			nxos = {
+				templates = [
+					{
+						name    = "base_cli"
+						type    = "cli"
+						content = "hostname $${name}\n$${include(\"ntp\", { server = \"10.0.0.9\" })}\n$${include(\"logging.tpl\")}"
+					},
+					{
+						name    = "ntp"
+						type    = "cli"
+						content = "ntp server $${server}"
+					},
+					{
+						name = "interfaces"
+						type = "file"
+						file = "interfaces.yaml"
+					}
+				]
+				global = {
+					templates = ["base_cli", "interfaces"]
+					variables = {
+						logging_server = "10.0.0.1"
+					}
+				}
+				devices = [
+					{
+						name = "spine1"
+						variables = {
+							name = "spine1"
+						}
+						configuration = {}
+					}
+				]
+			}
+		}
+
+		file_templates = {
+			"interfaces.yaml" = "system:\n  description: \"$${include(\"description.tpl\")}\"\n"
+			"description.tpl" = "$${name} managed by terraform"
+			"logging.tpl"     = "logging server $${logging_server}"
+		}
+
+		result = provider::utils::render_device_configs([], local.model, "", local.file_templates, [], [])
 		device = local.result.raw.nxos.devices[0]
 	}
 
-	output "hostname" {
-		value = local.device.configuration.system.hostname
+	output "cli_content" {
+		value = local.device.cli_templates[0].content
 	}
-	output "dns_server" {
-		value = local.device.configuration.system.dns_server
+	output "file_description" {
+		value = local.device.configuration.system.description
+	}
+	`
+}
+
+func TestRenderDeviceConfigsFunction_TemplateFunctions(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_templateFunctions(),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("description", "uplink to spine1 Ethernet1/49"),
+					resource.TestCheckOutput("cli_content", "description uplink to spine2 Ethernet1/50"),
+				),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_templateFunctions() string {
+	return `
+	locals {
+		model = {
+			nxos = {
+				templates = [
+					{
+						name       = "uplink_description"
+						type       = "function"
+						parameters = ["peer", { name = "port", type = "number" }]
+						expression = "\"uplink to $${peer} Ethernet1/$${port}\""
+					},
+					{
+						name = "uplinks"
+						type = "model"
+						configuration = {
+							system = {
+								description = "$${uplink_description(\"spine1\", 49)}"
+							}
+						}
+					},
+					{
+						name    = "uplink_cli"
+						type    = "cli"
+						content = "description $${uplink_description(\"spine2\", 50)}"
+					}
+				]
+				global = {
+					templates = ["uplinks", "uplink_cli"]
+				}
+				devices = [
+					{
+						name          = "leaf1"
+						configuration = {}
+					}
+				]
+			}
+		}
+
+		result = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+		device = local.result.raw.nxos.devices[0]
+	}
+
+	output "description" {
+		value = local.device.configuration.system.description
+	}
+	output "cli_content" {
+		value = local.device.cli_templates[0].content
+	}
+	`
+}
+
+func TestRenderDeviceConfigsFunction_TemplateLimits(t *testing.T) {
+	model := `
+	locals {
+		model = {
+			nxos = {
+				templates = [
+					{ name = "big", type = "cli", content = "%%{ for i in range(200) }interface $${i}\n%%{ endfor }" },
+				]
+				global  = { templates = ["big"] }
+				devices = [{ name = "spine1", configuration = {} }]
+			}
+		}
+	}
+	`
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: model + `
+				output "lines" {
+					value = length(split("\n", provider::utils::render_device_configs([], local.model, "", {}, [], []).raw.nxos.devices[0].cli_templates[0].content))
+				}
+				`,
+				Check: resource.TestCheckOutput("lines", "201"),
+			},
+			{
+				Config: model + `
+				output "test" {
+					value = provider::utils::render_device_configs([], local.model, "", {}, [], [], { max_template_output_size = 1000 })
+				}
+				`,
+				ExpectError: regexp.MustCompile(`device\s+spine1:\s+cli\s+templates:\s+global\s+cli\s+template\s+"big":\s+template\s+output\s+exceeds\s+the\s+maximum\s+output\s+size`),
+			},
+			{
+				Config: model + `
+				output "test" {
+					value = provider::utils::render_device_configs([], local.model, "", {}, [], [], { max_template_collection_size = 100 })
+				}
+				`,
+				ExpectError: regexp.MustCompile(`range\s+result\s+of\s+200\s+elements\s+exceeds`),
+			},
+			{
+				Config: model + `
+				output "test" {
+					value = provider::utils::render_device_configs([], local.model, "", {}, [], [], { max_template_collection_size = 0 })
+				}
+				`,
+				ExpectError: regexp.MustCompile(`must\s+be\s+a\s+positive\s+whole\s+number`),
+			},
+		},
+	})
+}
+
+func TestRenderDeviceConfigsFunction_MultipleArchitectures(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					model = {
+						nxos = {
+							templates = [
+								{ name = "mtu", type = "model", configuration = { system = { mtu = "$${mtu}" } } },
+							]
+							global  = { templates = ["mtu"], variables = { mtu = 9216 } }
+							devices = [{ name = "core1", url = "https://core1", configuration = {} }]
+						}
+						iosxe = {
+							templates = [
+								{ name = "banner", type = "cli", content = "banner motd $${site}" },
+							]
+							global  = { templates = ["banner"], variables = { site = "campus" } }
+							devices = [
+								{ name = "access1", host = "10.0.0.1", configuration = { system = { hostname = "access1" } } },
+								{ name = "access2", host = "10.0.0.2", configuration = {} },
+							]
+						}
+					}
+					defaults = <<-EOT
+					defaults:
+					  iosxe:
+					    devices:
+					      managed: false
+					EOT
+					result = provider::utils::render_device_configs([], local.model, local.defaults, {}, [], [])
+				}
+				output "nxos_mtu" {
+					value = local.result.raw.nxos.devices[0].configuration.system.mtu
+				}
+				output "iosxe_hostname" {
+					value = local.result.resolved.iosxe.devices[0].configuration.system.hostname
+				}
+				output "iosxe_banner" {
+					value = local.result.raw.iosxe.devices[1].cli_templates[0].content
+				}
+				output "iosxe_managed" {
+					value = local.result.raw.iosxe.devices[1].managed
+				}
+				output "provider_devices" {
+					value = join(",", [for d in local.result.provider_devices : "${d.architecture}/${d.name}/${d.managed}"])
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("nxos_mtu", "9216"),
+					resource.TestCheckOutput("iosxe_hostname", "access1"),
+					resource.TestCheckOutput("iosxe_banner", "banner motd campus"),
+					resource.TestCheckOutput("iosxe_managed", "false"),
+					resource.TestCheckOutput("provider_devices", "iosxe/access1/false,iosxe/access2/false,nxos/core1/true"),
+				),
+			},
+			{
+				Config: `
+				locals {
+					model = {
+						nxos  = { devices = [{ name = "core1", configuration = {} }] }
+						iosxe = {
+							templates = [{ name = "bad", type = "cli", content = "$${missing}" }]
+							global    = { templates = ["bad"] }
+							devices   = [{ name = "access1", configuration = {} }]
+						}
+					}
+				}
+				output "test" {
+					value = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+				}
+				`,
+				ExpectError: regexp.MustCompile(`iosxe:\s+device\s+access1:`),
+			},
+		},
+	})
+}
+
+func TestRenderDeviceConfigsFunction_Provenance(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					model = {
+						nxos = {
+							templates = [
+								{ name = "base", type = "model", configuration = { system = { mtu = 9216 } } },
+							]
+							global  = { templates = ["base"] }
+							devices = [{ name = "leaf1", configuration = { system = { hostname = "leaf1" } } }]
+						}
+					}
+					result  = provider::utils::render_device_configs([], local.model, "", {}, [], [], { provenance = true })
+					default = provider::utils::render_device_configs([], local.model, "", {}, [], [])
+				}
+				output "mtu_source" {
+					value = "${local.result.provenance.nxos.leaf1["system.mtu"].level}/${local.result.provenance.nxos.leaf1["system.mtu"].source}"
+				}
+				output "hostname_default" {
+					value = local.result.provenance.nxos.leaf1["system.hostname"].default
+				}
+				output "disabled" {
+					value = local.default.provenance == null
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("mtu_source", "global/base"),
+					resource.TestCheckOutput("hostname_default", "false"),
+					resource.TestCheckOutput("disabled", "true"),
+				),
+			},
+		},
+	})
+}
+
+func TestRenderDeviceConfigsFunction_TagMode(t *testing.T) {
+	t.Setenv("RENDER_TAG_MODE_HOSTNAME", "spine1-env")
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRenderDeviceConfigs_tagMode(),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("resolve", "spine1-env"),
+					resource.TestCheckOutput("preserve", "!env RENDER_TAG_MODE_HOSTNAME"),
+					resource.TestCheckOutput("strip", "false"),
+					resource.TestCheckOutput("tagged_paths", "nxos.devices[0].configuration.system.hostname"),
+				),
+			},
+			{
+				Config: `
+				locals {
+					yaml1 = <<-EOT
+nxos:
+  devices:
+    - name: spine1
+      configuration:
+        system:
+          hostname: !env RENDER_TAG_MODE_HOSTNAME
+EOT
+				}
+				output "test" {
+					value = provider::utils::render_device_configs([local.yaml1], {}, "", {}, [], [], { tag_mode = "fail" })
+				}
+				`,
+				ExpectError: regexp.MustCompile(`YAML tag\s+!env is not allowed`),
+			},
+		},
+	})
+}
+
+func testAccRenderDeviceConfigs_tagMode() string {
+	return `
+	locals {
+		yaml1 = <<-EOT
+nxos:
+  devices:
+    - name: spine1
+      configuration:
+        system:
+          hostname: !env RENDER_TAG_MODE_HOSTNAME
+EOT
+
+		resolve  = provider::utils::render_device_configs([local.yaml1], {}, "", {}, [], [])
+		preserve = provider::utils::render_device_configs([local.yaml1], {}, "", {}, [], [], { tag_mode = "preserve" })
+		strip    = provider::utils::render_device_configs([local.yaml1], {}, "", {}, [], [], { tag_mode = "strip" })
+	}
+
+	output "resolve" {
+		value = local.resolve.resolved.nxos.devices[0].configuration.system.hostname
+	}
+	output "preserve" {
+		value = local.preserve.resolved.nxos.devices[0].configuration.system.hostname
+	}
+	output "strip" {
+		value = can(local.strip.resolved.nxos.devices[0].configuration.system.hostname)
+	}
+	output "tagged_paths" {
+		value = join(",", local.resolve.tagged_paths)
 	}
 	`
 }
 
+// TestRenderDeviceConfigsFunction_SopsDocument verifies that values decrypted from
+// a SOPS document are listed in tagged_paths at the paths of every rendered device
+// they end up in.
+func TestRenderDeviceConfigsFunction_SopsDocument(t *testing.T) {
+	identity := testAgeIdentity(t)
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatalf("data key: %v", err)
+	}
+	enc := testAgeEncrypt(t, identity.Recipient(), dataKey, true)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "nxos:\n  global:\n    configuration:\n      snmp:\n")
+	fmt.Fprintf(&sb, "        community: %s\n", testSopsEncryptValue(t, dataKey, "secret", "str", "nxos:global:configuration:snmp:community:"))
+	fmt.Fprintf(&sb, "  devices:\n    - name: spine1\n      configuration:\n        system:\n")
+	fmt.Fprintf(&sb, "          hostname: %s\n", testSopsEncryptValue(t, dataKey, "spine1-secret", "str", "nxos:devices:configuration:system:hostname:"))
+	fmt.Fprintf(&sb, "    - name: spine2\n")
+	fmt.Fprintf(&sb, "sops:\n  age:\n    - recipient: %s\n      enc: |\n", identity.Recipient())
+	for _, line := range strings.Split(strings.TrimSpace(enc), "\n") {
+		fmt.Fprintf(&sb, "        %s\n", line)
+	}
+	fmt.Fprintf(&sb, "  version: 3.9.0\n")
+
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				locals {
+					encrypted = <<-EOT
+%s
+EOT
+					plain = <<-EOT
+nxos:
+  global:
+    configuration:
+      snmp:
+        location: dc1
+EOT
+					result = provider::utils::render_device_configs([local.encrypted, local.plain], {}, "", {}, [], [])
+				}
+				output "hostname" {
+					value = local.result.resolved.nxos.devices[0].configuration.system.hostname
+				}
+				output "tagged_paths" {
+					value = join(",", local.result.tagged_paths)
+				}
+				`, sb.String()),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("hostname", "spine1-secret"),
+					resource.TestCheckOutput("tagged_paths", "nxos.devices[0].configuration.snmp.community,nxos.devices[0].configuration.system.hostname,nxos.devices[1].configuration.snmp.community"),
+				),
+			},
+		},
+	})
+}
+
 func TestRenderDeviceConfigsFunction_ProviderDevices(t *testing.T) {
 	resource.UnitTest(t, resource.TestCase{
 		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
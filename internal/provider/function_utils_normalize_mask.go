@@ -20,6 +20,7 @@ package provider
 import (
 	"context"
 	"fmt"
+	"math/big"
 
 	"github.com/hashicorp/terraform-plugin-framework/function"
 	"github.com/hashicorp/terraform-plugin-framework/types"
@@ -51,6 +52,19 @@ func validateMaskPrefix(prefix int64) error {
 	return nil
 }
 
+// maskPrefix converts a mask prefix length number to an integer and validates it.
+// Fractional numbers are rejected rather than truncated.
+func maskPrefix(value *big.Float) (int64, error) {
+	prefix, accuracy := value.Int64()
+	if accuracy != big.Exact {
+		return 0, fmt.Errorf("mask prefix length %s must be a whole number", value.Text('f', -1))
+	}
+	if err := validateMaskPrefix(prefix); err != nil {
+		return 0, err
+	}
+	return prefix, nil
+}
+
 // convertPrefixToDottedDecimal converts a prefix length (0-32) to dotted-decimal notation
 func convertPrefixToDottedDecimal(prefix int64) string {
 	// Create a 32-bit mask with the first 'prefix' bits set to 1
@@ -117,11 +131,9 @@ func (r NormalizeMaskFunction) Run(ctx context.Context, req function.RunRequest,
 		return
 	}
 
-	// Extract integer value from mask
-	maskInt64, _ := maskValue.ValueBigFloat().Int64()
-
-	// Validate mask prefix length
-	if err := validateMaskPrefix(maskInt64); err != nil {
+	// Extract and validate the integer mask prefix length
+	maskInt64, err := maskPrefix(maskValue.ValueBigFloat())
+	if err != nil {
 		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(err.Error()))
 		return
 	}
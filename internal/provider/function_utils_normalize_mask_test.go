@@ -143,6 +143,21 @@ func TestNormalizeMaskFunction_NullInput(t *testing.T) {
 	})
 }
 
+func TestNormalizeMaskFunction_Fractional(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccFunctionUtilsNormalizeMask_fractional(),
+				ExpectError: regexp.MustCompile(`mask prefix length[\s\n]24.7[\s\n]must be a whole number`),
+			},
+		},
+	})
+}
+
 // Test configuration functions
 
 func testAccFunctionUtilsNormalizeMask_commonMasks() string {
@@ -213,6 +228,14 @@ func testAccFunctionUtilsNormalizeMask_outOfRangeHigh() string {
 	`
 }
 
+func testAccFunctionUtilsNormalizeMask_fractional() string {
+	return `
+	output "test" {
+		value = provider::utils::normalize_mask(24.7, "dotted-decimal")
+	}
+	`
+}
+
 func testAccFunctionUtilsNormalizeMask_outOfRangeLarge() string {
 	return `
 	output "test" {
@@ -68,6 +68,145 @@ func validateVlanRange(from, to int64) error {
 	return nil
 }
 
+// parseVlanSet collects the VLAN IDs of a normalize_vlans input, a native object
+// with optional `ids` and `ranges` attributes as returned by convertDynamicToNative
+// or ctyToNative. It is shared by the provider function and the template function.
+func parseVlanSet(input any) (map[int]bool, error) {
+	vlanSet := make(map[int]bool)
+	if input == nil {
+		return vlanSet, nil
+	}
+	obj, ok := input.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("Input must be an object")
+	}
+
+	if idsVal := obj["ids"]; idsVal != nil {
+		ids, ok := idsVal.([]any)
+		if !ok {
+			return nil, fmt.Errorf("IDs must be a list or tuple")
+		}
+		for _, v := range ids {
+			id, ok := vlanNumber(v)
+			if !ok {
+				return nil, fmt.Errorf("All IDs must be whole numbers")
+			}
+			if err := validateVlanID(id); err != nil {
+				return nil, fmt.Errorf("in 'ids' field: %v", err)
+			}
+			vlanSet[int(id)] = true
+		}
+	}
+
+	if rangesVal := obj["ranges"]; rangesVal != nil {
+		ranges, ok := rangesVal.([]any)
+		if !ok {
+			return nil, fmt.Errorf("Ranges must be a list or tuple")
+		}
+		for _, r := range ranges {
+			rangeObj, ok := r.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("Range elements must be objects")
+			}
+			if rangeObj["from"] == nil {
+				return nil, fmt.Errorf("Range missing 'from' field")
+			}
+			if rangeObj["to"] == nil {
+				return nil, fmt.Errorf("Range missing 'to' field")
+			}
+			from, ok := vlanNumber(rangeObj["from"])
+			if !ok {
+				return nil, fmt.Errorf("Range 'from' must be a whole number")
+			}
+			to, ok := vlanNumber(rangeObj["to"])
+			if !ok {
+				return nil, fmt.Errorf("Range 'to' must be a whole number")
+			}
+			if err := validateVlanRange(from, to); err != nil {
+				return nil, fmt.Errorf("in 'ranges' field: %v", err)
+			}
+			for i := from; i <= to; i++ {
+				vlanSet[int(i)] = true
+			}
+		}
+	}
+	return vlanSet, nil
+}
+
+// vlanNumber returns the integer value of a native number. Fractional numbers,
+// which convertDynamicToNative and ctyToNative return as float64, are rejected.
+func vlanNumber(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+// sortedVlanIDs returns the VLAN IDs in vlanSet in ascending order
+func sortedVlanIDs(vlanSet map[int]bool) []int {
+	var vlans []int
+	for vlan := range vlanSet {
+		vlans = append(vlans, vlan)
+	}
+	sort.Ints(vlans)
+	return vlans
+}
+
+// formatVlanIDs formats sorted VLAN IDs as a comma-separated string with range notation
+func formatVlanIDs(vlans []int, format string) string {
+	if len(vlans) == 0 {
+		return ""
+	}
+
+	// Determine the minimum consecutive count to use range notation
+	minRangeSize := 3 // default for "string" format
+	if format == FormatStringNxos {
+		minRangeSize = 2
+	}
+
+	var result []string
+	start := vlans[0]
+	end := vlans[0]
+
+	for i := 1; i < len(vlans); i++ {
+		if vlans[i] == end+1 {
+			// Consecutive VLAN, extend the range
+			end = vlans[i]
+		} else {
+			// Non-consecutive VLAN, finalize the current range
+			rangeSize := end - start + 1
+			if rangeSize >= minRangeSize {
+				// Use range notation for consecutive VLANs meeting threshold
+				result = append(result, fmt.Sprintf("%d-%d", start, end))
+			} else {
+				// Output individual VLANs
+				for j := start; j <= end; j++ {
+					result = append(result, strconv.Itoa(j))
+				}
+			}
+			start = vlans[i]
+			end = vlans[i]
+		}
+	}
+
+	// Add the final range
+	rangeSize := end - start + 1
+	if rangeSize >= minRangeSize {
+		// Use range notation for consecutive VLANs meeting threshold
+		result = append(result, fmt.Sprintf("%d-%d", start, end))
+	} else {
+		// Output individual VLANs
+		for j := start; j <= end; j++ {
+			result = append(result, strconv.Itoa(j))
+		}
+	}
+
+	return strings.Join(result, ",")
+}
+
 func NewNormalizeVlansFunction() function.Function {
 	return &NormalizeVlansFunction{}
 }
@@ -111,9 +250,6 @@ func (r NormalizeVlansFunction) Run(ctx context.Context, req function.RunRequest
 		return
 	}
 
-	// Collect all VLAN IDs
-	vlanSet := make(map[int]bool)
-
 	// Handle empty input
 	if input.IsNull() || input.IsUnknown() {
 		if formatValue == FormatList {
@@ -130,149 +266,18 @@ func (r NormalizeVlansFunction) Run(ctx context.Context, req function.RunRequest
 		return
 	}
 
-	// Handle object input by checking the underlying value
-	switch obj := input.UnderlyingValue().(type) {
-	case types.Object:
-		elements := obj.Attributes()
-
-		// Handle IDs attribute if present
-		if idsVal, exists := elements["ids"]; exists && !idsVal.IsNull() && !idsVal.IsUnknown() {
-			// Handle Tuple values (HCL literal arrays like [1, 2, 5])
-			if idsTuple, ok := idsVal.(types.Tuple); ok {
-				var ids []int64
-				// Convert tuple elements to int64 slice
-				tupleElements := idsTuple.Elements()
-				for _, elem := range tupleElements {
-					if numVal, ok := elem.(types.Number); ok {
-						val, _ := numVal.ValueBigFloat().Int64()
-						ids = append(ids, val)
-					} else {
-						resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("All IDs must be numbers"))
-						return
-					}
-				}
-
-				// Add individual IDs
-				for _, id := range ids {
-					if err := validateVlanID(id); err != nil {
-						resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("in 'ids' field: %v", err)))
-						return
-					}
-					vlanSet[int(id)] = true
-				}
-			} else if idsList, ok := idsVal.(types.List); ok {
-				// Handle List values
-				var ids []int64
-				diags := idsList.ElementsAs(ctx, &ids, false)
-				if diags.HasError() {
-					resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Failed to parse IDs list"))
-					return
-				}
-
-				// Add individual IDs
-				for _, id := range ids {
-					if err := validateVlanID(id); err != nil {
-						resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("in 'ids' field: %v", err)))
-						return
-					}
-					vlanSet[int(id)] = true
-				}
-			} else {
-				resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("IDs must be a list or tuple, got %T", idsVal)))
-				return
-			}
-		}
-
-		// Handle Ranges attribute if present
-		if rangesVal, exists := elements["ranges"]; exists && !rangesVal.IsNull() && !rangesVal.IsUnknown() {
-			// Handle Tuple values (HCL literal arrays)
-			if rangesTuple, ok := rangesVal.(types.Tuple); ok {
-				tupleElements := rangesTuple.Elements()
-				for _, elem := range tupleElements {
-					if obj, ok := elem.(types.Object); ok {
-						attrs := obj.Attributes()
-						var from, to int64
-
-						// Extract 'from' field
-						if fromVal, exists := attrs["from"]; exists {
-							if fromNum, ok := fromVal.(types.Number); ok {
-								from, _ = fromNum.ValueBigFloat().Int64()
-							} else {
-								resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Range 'from' must be a number"))
-								return
-							}
-						} else {
-							resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Range missing 'from' field"))
-							return
-						}
-
-						// Extract 'to' field
-						if toVal, exists := attrs["to"]; exists {
-							if toNum, ok := toVal.(types.Number); ok {
-								to, _ = toNum.ValueBigFloat().Int64()
-							} else {
-								resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Range 'to' must be a number"))
-								return
-							}
-						} else {
-							resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Range missing 'to' field"))
-							return
-						}
-
-						// Validate range using helper function
-						if err := validateVlanRange(from, to); err != nil {
-							resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("in 'ranges' field: %v", err)))
-							return
-						}
-
-						// Add range to set
-						for i := from; i <= to; i++ {
-							vlanSet[int(i)] = true
-						}
-					} else {
-						resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Range elements must be objects"))
-						return
-					}
-				}
-			} else if rangesList, ok := rangesVal.(types.List); ok {
-				// Handle List values (fallback)
-				var ranges []struct {
-					From int64 `tfsdk:"from"`
-					To   int64 `tfsdk:"to"`
-				}
-				diags := rangesList.ElementsAs(ctx, &ranges, false)
-				if diags.HasError() {
-					resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Failed to parse ranges list"))
-					return
-				}
-
-				// Add ranges using helper function
-				for _, r := range ranges {
-					if err := validateVlanRange(r.From, r.To); err != nil {
-						resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("in 'ranges' field: %v", err)))
-						return
-					}
-					for i := r.From; i <= r.To; i++ {
-						vlanSet[int(i)] = true
-					}
-				}
-			} else {
-				resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("Ranges must be a list or tuple, got %T", rangesVal)))
-				return
-			}
-		}
-
-	default:
-		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Input must be an object"))
+	native, err := convertDynamicToNative(input)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting input: "+err.Error()))
 		return
 	}
-
-	// Convert to sorted slice
-	var vlans []int
-	for vlan := range vlanSet {
-		vlans = append(vlans, vlan)
+	vlanSet, err := parseVlanSet(native)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(err.Error()))
+		return
 	}
-	sort.Ints(vlans)
+
+	vlans := sortedVlanIDs(vlanSet)
 
 	// Handle empty result
 	if len(vlans) == 0 {
@@ -310,50 +315,7 @@ func (r NormalizeVlansFunction) Run(ctx context.Context, req function.RunRequest
 		resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, dynamicValue))
 	} else {
 		// Return as string with range notation
-		// Determine the minimum consecutive count to use range notation
-		minRangeSize := 3 // default for "string" format
-		if formatValue == FormatStringNxos {
-			minRangeSize = 2
-		}
-
-		var result []string
-		start := vlans[0]
-		end := vlans[0]
-
-		for i := 1; i < len(vlans); i++ {
-			if vlans[i] == end+1 {
-				// Consecutive VLAN, extend the range
-				end = vlans[i]
-			} else {
-				// Non-consecutive VLAN, finalize the current range
-				rangeSize := end - start + 1
-				if rangeSize >= minRangeSize {
-					// Use range notation for consecutive VLANs meeting threshold
-					result = append(result, fmt.Sprintf("%d-%d", start, end))
-				} else {
-					// Output individual VLANs
-					for j := start; j <= end; j++ {
-						result = append(result, strconv.Itoa(j))
-					}
-				}
-				start = vlans[i]
-				end = vlans[i]
-			}
-		}
-
-		// Add the final range
-		rangeSize := end - start + 1
-		if rangeSize >= minRangeSize {
-			// Use range notation for consecutive VLANs meeting threshold
-			result = append(result, fmt.Sprintf("%d-%d", start, end))
-		} else {
-			// Output individual VLANs
-			for j := start; j <= end; j++ {
-				result = append(result, strconv.Itoa(j))
-			}
-		}
-
-		output := strings.Join(result, ",")
+		output := formatVlanIDs(vlans, formatValue)
 		resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, output))
 	}
 }
\ No newline at end of file
@@ -25,6 +25,38 @@ import (
 	"github.com/hashicorp/terraform-plugin-testing/tfversion"
 )
 
+func TestParseVlanSet(t *testing.T) {
+	// Both native forms: int from convertDynamicToNative, int64 from ctyToNative
+	vlanSet, err := parseVlanSet(map[string]any{
+		"ids":    []any{1, int64(5)},
+		"ranges": []any{map[string]any{"from": int64(10), "to": 12}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := formatVlanIDs(sortedVlanIDs(vlanSet), FormatString); got != "1,5,10-12" {
+		t.Errorf("expected 1,5,10-12, got %s", got)
+	}
+
+	tests := []struct {
+		input   any
+		message string
+	}{
+		{"1-10", "Input must be an object"},
+		{map[string]any{"ids": 1}, "IDs must be a list or tuple"},
+		{map[string]any{"ids": []any{1.5}}, "All IDs must be whole numbers"},
+		{map[string]any{"ids": []any{"1"}}, "All IDs must be whole numbers"},
+		{map[string]any{"ranges": []any{map[string]any{"to": 1}}}, "Range missing 'from' field"},
+		{map[string]any{"ranges": []any{map[string]any{"from": 1, "to": 2.5}}}, "Range 'to' must be a whole number"},
+		{map[string]any{"ranges": []any{1}}, "Range elements must be objects"},
+	}
+	for _, tt := range tests {
+		if _, err := parseVlanSet(tt.input); err == nil || err.Error() != tt.message {
+			t.Errorf("%v: expected error %q, got %v", tt.input, tt.message, err)
+		}
+	}
+}
+
 func TestNormalizeVlansFunction_Known(t *testing.T) {
 	resource.UnitTest(t, resource.TestCase{
 		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
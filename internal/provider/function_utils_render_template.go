@@ -0,0 +1,290 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyfunction "github.com/zclconf/go-cty/cty/function"
+)
+
+// Result types accepted by the result_type option of render_template
+const (
+	ResultTypeString = "string" // Always return a string (default)
+	ResultTypeValue  = "value"  // Return the raw value of single-expression templates
+)
+
+var ValidResultTypes = map[string]bool{
+	ResultTypeString: true,
+	ResultTypeValue:  true,
+}
+
+// nullToEmptyFuncName is the name under which templateNullToEmptyFunc is made
+// available to lenient templates. It is not a valid HCL identifier, so it cannot
+// be called from the template itself.
+const nullToEmptyFuncName = "render_template:null_to_empty"
+
+// templateNullToEmptyFunc replaces a null value with an empty string and returns
+// any other value unchanged.
+var templateNullToEmptyFunc = ctyfunction.New(&ctyfunction.Spec{
+	Params: []ctyfunction.Parameter{
+		{
+			Name:             "value",
+			Type:             cty.DynamicPseudoType,
+			AllowNull:        true,
+			AllowUnknown:     true,
+			AllowDynamicType: true,
+			AllowMarked:      true,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		return cty.DynamicPseudoType, nil
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if args[0].IsNull() {
+			return cty.StringVal(""), nil
+		}
+		return args[0], nil
+	},
+})
+
+var _ function.Function = RenderTemplateFunction{}
+
+func NewRenderTemplateFunction() function.Function {
+	return &RenderTemplateFunction{}
+}
+
+type RenderTemplateFunction struct{}
+
+func (r RenderTemplateFunction) Metadata(_ context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "render_template"
+}
+
+func (r RenderTemplateFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary: "Render an HCL template with the render_device_configs function set",
+		MarkdownDescription: "Render an HCL template string, like Terraform's `templatestring`, using the same template engine and functions as `render_device_configs` " +
+			"(including `try`, `can`, network, normalization, hashing and encoding functions). " +
+			"By default `null` values render as an empty string and the result is unknown while any variable is unknown. " +
+			"With `strict` set, interpolating `null` and passing unknown variables are errors instead.",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                "template",
+				MarkdownDescription: "The HCL template string to render.",
+			},
+			function.DynamicParameter{
+				Name:                "vars",
+				AllowNullValue:      true,
+				AllowUnknownValues:  true,
+				MarkdownDescription: "A map or object of the variables available to the template.",
+			},
+		},
+		VariadicParameter: function.DynamicParameter{
+			Name:           "options",
+			AllowNullValue: true,
+			MarkdownDescription: "An optional object with additional settings. " +
+				"`strict` (default `false`) reports `null` interpolations and unknown variables as errors. " +
+				"`result_type` controls the returned type: `string` (default) always returns a string, while `value` returns the raw value of a template consisting of a single interpolation such as `${var.list}`. " +
+				"`trim_trailing_whitespace` (default `false`) removes trailing spaces and tabs from every line of a string result.",
+		},
+		Return: function.DynamicReturn{},
+	}
+}
+
+func (r RenderTemplateFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var tmpl string
+	var vars types.Dynamic
+	var options []types.Dynamic
+
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &tmpl, &vars, &options))
+	if resp.Error != nil {
+		return
+	}
+
+	opts, err := parseFunctionOptions(options, OptionStrict, OptionResultType, OptionTrimTrailingWhitespace)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	strict, err := optionBool(opts, OptionStrict, false)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	resultType, err := optionString(opts, OptionResultType, ResultTypeString)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	if !ValidResultTypes[resultType] {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("Invalid options: invalid result_type '%s'. Must be one of: 'string', 'value'", resultType)))
+		return
+	}
+	trim, err := optionBool(opts, OptionTrimTrailingWhitespace, false)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+
+	tfVars, err := vars.ToTerraformValue(ctx)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting vars: "+err.Error()))
+		return
+	}
+	if !tfVars.IsFullyKnown() {
+		if strict {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error rendering template: vars contain unknown values"))
+			return
+		}
+		resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, types.DynamicUnknown()))
+		return
+	}
+
+	ctyVars := map[string]cty.Value{}
+	if !vars.IsNull() {
+		native, err := convertDynamicToNative(vars)
+		if err != nil {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting vars: "+err.Error()))
+			return
+		}
+		m, ok := native.(map[string]any)
+		if !ok {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting vars: must be a map or object"))
+			return
+		}
+		ctyVars, err = nativeToCtyMap(m)
+		if err != nil {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting vars: "+err.Error()))
+			return
+		}
+	}
+
+	limits := newTemplateLimits(ctx, DefaultMaxTemplateOutputSize, DefaultMaxTemplateCollectionSize)
+	result, err := renderStandaloneTemplate(tmpl, ctyVars, strict, resultType, trim, limits)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error rendering template: "+err.Error()))
+		return
+	}
+
+	dynResult, err := convertNativeToDynamic(ctx, result)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting result: "+err.Error()))
+		return
+	}
+	resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, dynResult))
+}
+
+// renderStandaloneTemplate renders tmpl for the render_template function. Unless
+// strict is set, every interpolation is wrapped so that null values render as an
+// empty string instead of failing. With result_type "string" the result is
+// converted to a string; with "value" single-expression templates keep their type.
+// If limits is not nil, the evaluation is subject to it.
+func renderStandaloneTemplate(tmpl string, vars map[string]cty.Value, strict bool, resultType string, trim bool, limits *templateLimits) (any, error) {
+	expr, diags := hclsyntax.ParseTemplate([]byte(tmpl), "template", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parsing template: %s", diags.Error())
+	}
+
+	funcs := hclTemplateFunctions()
+	if !strict {
+		wrapTemplateInterpolations(expr)
+		funcs[nullToEmptyFuncName] = templateNullToEmptyFunc
+	}
+	limits.install(funcs)
+	limits.instrument(expr)
+
+	val, diags := expr.Value(&hcl.EvalContext{
+		Variables: vars,
+		Functions: funcs,
+	})
+	if err := limits.error(); err != nil {
+		return nil, err
+	}
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("evaluating template: %s", diags.Error())
+	}
+
+	if resultType == ResultTypeString {
+		if val.IsNull() && !strict {
+			val = cty.StringVal("")
+		}
+		str, err := convert.Convert(val, cty.String)
+		if err != nil {
+			return nil, fmt.Errorf("template result is %s, not string", val.Type().FriendlyName())
+		}
+		val = str
+	}
+	if val.IsNull() && strict {
+		return nil, fmt.Errorf("template result is null")
+	}
+
+	native, err := ctyToNative(val)
+	if err != nil {
+		return nil, fmt.Errorf("converting template result: %w", err)
+	}
+	if s, ok := native.(string); ok {
+		if err := limits.checkOutput(len(s)); err != nil {
+			return nil, err
+		}
+		if trim {
+			native = trimTrailingWhitespace(s)
+		}
+	}
+	return native, nil
+}
+
+// wrapTemplateInterpolations rewrites every interpolation in a parsed template to
+// pass through templateNullToEmptyFunc, so that null values render as "".
+func wrapTemplateInterpolations(expr hclsyntax.Expression) {
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		te, ok := node.(*hclsyntax.TemplateExpr)
+		if !ok {
+			return nil
+		}
+		for i, part := range te.Parts {
+			if _, literal := part.(*hclsyntax.LiteralValueExpr); literal {
+				continue
+			}
+			te.Parts[i] = &hclsyntax.FunctionCallExpr{
+				Name:            nullToEmptyFuncName,
+				Args:            []hclsyntax.Expression{part},
+				NameRange:       part.Range(),
+				OpenParenRange:  part.Range(),
+				CloseParenRange: part.Range(),
+			}
+		}
+		return nil
+	})
+}
+
+// trimTrailingWhitespace removes trailing spaces and tabs from every line of s.
+func trimTrailingWhitespace(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,168 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/tfversion"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Unit tests for the renderStandaloneTemplate helper
+
+func TestRenderStandaloneTemplate(t *testing.T) {
+	vars := map[string]cty.Value{
+		"name":    cty.StringVal("leaf1"),
+		"asn":     cty.NumberIntVal(65001),
+		"missing": cty.NullVal(cty.String),
+		"servers": cty.TupleVal([]cty.Value{cty.StringVal("10.0.0.1"), cty.StringVal("10.0.0.2")}),
+	}
+
+	tests := []struct {
+		name       string
+		tmpl       string
+		strict     bool
+		resultType string
+		trim       bool
+		expected   any
+		wantErr    string
+	}{
+		{name: "interpolation", tmpl: "hostname ${upper(name)}", resultType: ResultTypeString, expected: "hostname LEAF1"},
+		{name: "try", tmpl: `${try(nope.x, "fallback")}`, resultType: ResultTypeString, expected: "fallback"},
+		{name: "number as string", tmpl: "${asn}", resultType: ResultTypeString, expected: "65001"},
+		{name: "number as value", tmpl: "${asn}", resultType: ResultTypeValue, expected: int64(65001)},
+		{name: "list as value", tmpl: "${servers}", resultType: ResultTypeValue, expected: []any{"10.0.0.1", "10.0.0.2"}},
+		{name: "list as string", tmpl: "${servers}", resultType: ResultTypeString, wantErr: "not string"},
+		{name: "null lenient", tmpl: "a${missing}b", resultType: ResultTypeString, expected: "ab"},
+		{name: "null lenient in loop", tmpl: "%{ for s in [missing, name] }[${s}]%{ endfor }", resultType: ResultTypeString, expected: "[][leaf1]"},
+		{name: "null lenient single", tmpl: "${missing}", resultType: ResultTypeString, expected: ""},
+		{name: "null lenient value", tmpl: "${missing}", resultType: ResultTypeValue, expected: nil},
+		{name: "null strict", tmpl: "a${missing}b", strict: true, resultType: ResultTypeString, wantErr: "null"},
+		{name: "null strict single", tmpl: "${missing}", strict: true, resultType: ResultTypeValue, wantErr: "template result is null"},
+		{name: "null check strict", tmpl: `${missing == null ? "none" : missing}`, strict: true, resultType: ResultTypeString, expected: "none"},
+		{name: "trim", tmpl: "a  \nb\t\nc ", resultType: ResultTypeString, trim: true, expected: "a\nb\nc"},
+		{name: "no trim", tmpl: "a  \n", resultType: ResultTypeString, expected: "a  \n"},
+		{name: "undefined variable", tmpl: "${nope}", resultType: ResultTypeString, wantErr: "evaluating template"},
+		{name: "parse error", tmpl: "${name", resultType: ResultTypeString, wantErr: "parsing template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderStandaloneTemplate(tt.tmpl, vars, tt.strict, tt.resultType, tt.trim, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v (result %v)", tt.wantErr, err, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenderStandaloneTemplate_InternalFunctionNotCallable(t *testing.T) {
+	if _, err := renderStandaloneTemplate("${render_template:null_to_empty(name)}", map[string]cty.Value{"name": cty.StringVal("x")}, false, ResultTypeString, false, nil); err == nil {
+		t.Fatal("expected error when calling the internal null function directly")
+	}
+}
+
+// Acceptance tests for the Terraform function
+
+func TestRenderTemplateFunction_Basic(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					vars = {
+						name    = "leaf1"
+						servers = ["10.0.0.1", "10.0.0.2"]
+						vrf     = null
+					}
+				}
+				output "string" {
+					value = provider::utils::render_template("hostname $${upper(name)} host $${cidrhost(\"10.0.0.0/24\", 5)} vrf=$${vrf}", local.vars)
+				}
+				output "value" {
+					value = length(provider::utils::render_template("$${servers}", local.vars, { result_type = "value" }))
+				}
+				output "trimmed" {
+					value = provider::utils::render_template("a  \nb", local.vars, { trim_trailing_whitespace = true })
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("string", "hostname LEAF1 host 10.0.0.5 vrf="),
+					resource.TestCheckOutput("value", "2"),
+					resource.TestCheckOutput("trimmed", "a\nb"),
+				),
+			},
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::render_template("vrf $${vrf}", { vrf = null }, { strict = true })
+				}
+				`,
+				ExpectError: regexp.MustCompile(`Error\s+rendering\s+template`),
+			},
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::render_template("x", {}, { result_type = "list" })
+				}
+				`,
+				ExpectError: regexp.MustCompile(`invalid\s+result_type`),
+			},
+		},
+	})
+}
+
+func TestRenderTemplateFunction_Unknown(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				resource "terraform_data" "name" {
+					input = "leaf1"
+				}
+				output "test" {
+					value = provider::utils::render_template("hostname $${name}", { name = terraform_data.name.output })
+				}
+				`,
+				Check: resource.TestCheckOutput("test", "hostname leaf1"),
+			},
+		},
+	})
+}
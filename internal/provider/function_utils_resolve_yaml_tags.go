@@ -40,7 +40,7 @@ func (r ResolveYamlTagsFunction) Metadata(_ context.Context, req function.Metada
 func (r ResolveYamlTagsFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
 	resp.Definition = function.Definition{
 		Summary:             "Resolve YAML tags in a data structure",
-		MarkdownDescription: "Recursively walk a data structure and resolve YAML tag strings. Currently supports the `!env VARNAME` tag, which is resolved to the value of the corresponding environment variable. This is intended to be used after `yaml_decode` which preserves unknown YAML tags as literal strings.",
+		MarkdownDescription: "Recursively walk a data structure and resolve YAML tag strings. Currently supports the `!env VARNAME` tag, which is resolved to the value of the corresponding environment variable, and the `!age CIPHERTEXT` tag, which is decrypted with the age identity from `SOPS_AGE_KEY` or `SOPS_AGE_KEY_FILE`. The transform tags `!base64`, `!base64decode`, `!sha256`, `!json` and `!yaml` resolve their argument first and can be stacked on other tags, e.g. `!base64 \"!env BANNER\"`. User-defined tags can be declared in the `custom_tags` option, other unknown tags are reported as errors. The `!ref path.to.value` tag is replaced with the value at that path in the input, e.g. `devices[name=leaf1].asn`. This is intended to be used after `yaml_decode` which preserves unknown YAML tags as literal strings. Access to environment variables can be restricted with the comma-separated `UTILS_ENV_ALLOWLIST` and `UTILS_ENV_DENYLIST` environment variables.",
 		Parameters: []function.Parameter{
 			function.DynamicParameter{
 				Name:                "input",
@@ -49,18 +49,35 @@ func (r ResolveYamlTagsFunction) Definition(_ context.Context, _ function.Defini
 				MarkdownDescription: "The data structure to resolve YAML tags in. Can be any Terraform value type.",
 			},
 		},
+		VariadicParameter: function.DynamicParameter{
+			Name:                "options",
+			AllowNullValue:      true,
+			MarkdownDescription: "An optional object with additional settings. `custom_tags` declares user-defined tags like the provider `custom_tags` attribute, e.g. `{ site_asn = { value = \"65000\" } }`.",
+		},
 		Return: function.DynamicReturn{},
 	}
 }
 
 func (r ResolveYamlTagsFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
 	var inputDynamic types.Dynamic
+	var options []types.Dynamic
 
-	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &inputDynamic))
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &inputDynamic, &options))
 	if resp.Error != nil {
 		return
 	}
 
+	opts, err := parseFunctionOptions(options, OptionCustomTags)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	resolver, err := newFunctionTagResolver(opts)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+
 	// Security control: Add timeout protection
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -79,12 +96,19 @@ func (r ResolveYamlTagsFunction) Run(ctx context.Context, req function.RunReques
 	}
 
 	// Resolve YAML tags in the native value
-	resolved, err := resolveYamlTags(native)
+	resolved, err := resolver.resolve(native)
 	if err != nil {
 		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error resolving YAML tags: "+err.Error()))
 		return
 	}
 
+	// Resolve !ref tags against the resolved structure
+	resolved, err = resolveYamlRefs(resolved)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error resolving YAML references: "+err.Error()))
+		return
+	}
+
 	// Convert back to Terraform Dynamic type
 	result, err := convertNativeToDynamic(ctx, resolved)
 	if err != nil {
@@ -20,6 +20,7 @@ package provider
 import (
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
@@ -156,7 +157,7 @@ func TestResolveYamlTags_StringWithoutTag(t *testing.T) {
 		"hello",
 		"!envNOSPACE",
 		"env VALUE",
-		"!secret VALUE",
+		"!",
 		"",
 	}
 	for _, s := range tests {
@@ -170,6 +171,331 @@ func TestResolveYamlTags_StringWithoutTag(t *testing.T) {
 	}
 }
 
+func TestResolveYamlTags_TransformTags(t *testing.T) {
+	os.Setenv("TEST_TRANSFORM_BANNER", "Authorized access only")
+	defer os.Unsetenv("TEST_TRANSFORM_BANNER")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"!base64 hello", "aGVsbG8="},
+		{"!base64decode aGVsbG8=", "hello"},
+		{"!sha256 hello", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"!base64 !env TEST_TRANSFORM_BANNER", "QXV0aG9yaXplZCBhY2Nlc3Mgb25seQ=="},
+		{"!base64decode !base64 !env TEST_TRANSFORM_BANNER", "Authorized access only"},
+	}
+	for _, tt := range tests {
+		result, err := resolveYamlTags(tt.input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tt.input, err)
+		}
+		if result != tt.expected {
+			t.Errorf("%q: expected %q, got %v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestResolveYamlTags_JsonAndYamlTags(t *testing.T) {
+	os.Setenv("TEST_TRANSFORM_JSON", `{"b": 1, "a": [true, "x"]}`)
+	defer os.Unsetenv("TEST_TRANSFORM_JSON")
+	os.Setenv("TEST_TRANSFORM_INNER", "inner_value")
+	defer os.Unsetenv("TEST_TRANSFORM_INNER")
+
+	result, err := resolveYamlTags("!json !env TEST_TRANSFORM_JSON")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m, ok := result.(*OrderedMap)
+	if !ok {
+		t.Fatalf("expected *OrderedMap, got %T", result)
+	}
+	if entries := m.Entries(); len(entries) != 2 || entries[0].Key != "b" || entries[1].Key != "a" {
+		t.Errorf("expected keys [b a], got %v", entries)
+	}
+	if v, _ := m.Get("b"); v != 1 {
+		t.Errorf("b: expected 1, got %v", v)
+	}
+
+	decoded, err := yamlDecode("config: !yaml |\n  name: leaf1\n  secret: !env TEST_TRANSFORM_INNER\n")
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	result, err = resolveYamlTags(decoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config, _ := result.(*OrderedMap).Get("config")
+	cm, ok := config.(*OrderedMap)
+	if !ok {
+		t.Fatalf("expected *OrderedMap, got %T", config)
+	}
+	if v, _ := cm.Get("secret"); v != "inner_value" {
+		t.Errorf("secret: expected 'inner_value', got %v", v)
+	}
+}
+
+func TestResolveYamlTags_TransformErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{"!base64decode not-base64!", "failed to decode base64"},
+		{"!json {invalid", "invalid JSON"},
+		{"!base64 !ref a.b", "cannot be applied to a !ref tag"},
+		{"!base64 !json [1]", "expects a string argument"},
+	}
+	for _, tt := range tests {
+		_, err := resolveYamlTags(map[string]any{"value": tt.input})
+		if err == nil {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.message) || !strings.HasPrefix(err.Error(), "value: ") {
+			t.Errorf("%q: unexpected error message: %v", tt.input, err)
+		}
+	}
+}
+
+func TestResolveYamlTags_UnknownTag(t *testing.T) {
+	_, err := resolveYamlTags(map[string]any{"devices": []any{map[string]any{"password": "!evn DEVICE_PASSWORD"}}})
+	if err == nil {
+		t.Fatal("expected error for unknown tag")
+	}
+	if err.Error() != "devices[0].password: unknown YAML tag !evn" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestResolveYamlTags_CustomTags(t *testing.T) {
+	t.Setenv("CUSTOM_TAG_VRF", "management")
+	value := "65000"
+	r := &tagResolver{custom: map[string]customTag{
+		"!site_asn": {value: &value},
+		"!mgmt_vrf": {env: "CUSTOM_TAG_VRF"},
+		"!loopback": {template: "10.0.0.${argument}"},
+	}}
+
+	input, err := yamlDecode("asn: !site_asn\nvrf: !mgmt_vrf\nloopback: !loopback 1\nencoded: !base64 \"!mgmt_vrf \"\n")
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	result, err := r.resolve(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := yamlEncode(result)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	expected := "asn: 65000\nvrf: management\nloopback: 10.0.0.1\nencoded: bWFuYWdlbWVudA==\n"
+	if out != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", out, expected)
+	}
+}
+
+func TestNewFunctionTagResolver(t *testing.T) {
+	r, err := newFunctionTagResolver(map[string]any{
+		OptionCustomTags: map[string]any{
+			"site_asn": map[string]any{"value": 65000},
+			"loopback": map[string]any{"template": "10.0.0.${argument}"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result, err := r.resolve(map[string]any{"asn": "!site_asn ", "loopback": "!loopback 1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := result.(map[string]any)
+	if m["asn"] != 65000 || m["loopback"] != "10.0.0.1" {
+		t.Errorf("expected custom tags to be resolved, got %v", m)
+	}
+	if _, err := r.resolve(map[string]any{"password": "!evn DEVICE_PASSWORD"}); err == nil || !strings.Contains(err.Error(), "unknown YAML tag !evn") {
+		t.Errorf("expected unknown tag error, got %v", err)
+	}
+
+	input := map[string]any{"asn": "!site_asn ", "note": "!important note", "other": "!unknown_tag x"}
+
+	stripped, err := r.applyTagMode(input, TagModeStrip)
+	if err != nil {
+		t.Fatalf("strip: unexpected error: %v", err)
+	}
+	if sm := stripped.(map[string]any); sm["asn"] != nil || sm["note"] != nil || sm["other"] != nil {
+		t.Errorf("strip: expected all tags to be stripped, got %v", sm)
+	}
+	if _, err := r.applyTagMode(map[string]any{"note": "!important note"}, TagModeFail); err == nil || !strings.Contains(err.Error(), "!important is not allowed") {
+		t.Errorf("fail: expected error for unknown tag, got %v", err)
+	}
+
+	for _, opts := range []map[string]any{
+		{OptionCustomTags: "site_asn"},
+		{OptionCustomTags: map[string]any{"site_asn": "65000"}},
+		{OptionCustomTags: map[string]any{"site_asn": map[string]any{"valu": "65000"}}},
+		{OptionCustomTags: map[string]any{"site_asn": map[string]any{"value": "1", "env": "X"}}},
+		{OptionCustomTags: map[string]any{"env": map[string]any{"value": "1"}}},
+	} {
+		if _, err := newFunctionTagResolver(opts); err == nil || !strings.HasPrefix(err.Error(), "option custom_tags") {
+			t.Errorf("%v: expected custom_tags error, got %v", opts, err)
+		}
+	}
+}
+
+func TestResolveYamlTagsFunction_CustomTags(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					input = provider::utils::yaml_decode("asn: !site_asn 1\n")
+					custom_tags = {
+						site_asn = { template = "6500$${argument}" }
+					}
+					resolved = provider::utils::resolve_yaml_tags(local.input, { custom_tags = local.custom_tags })
+					merged   = provider::utils::yaml_merge(["asn: !site_asn 2\n"], { custom_tags = local.custom_tags })
+					rendered = provider::utils::render_device_configs(["nxos:\n  devices:\n    - name: leaf1\n      configuration:\n        asn: !site_asn 3\n"], {}, "", {}, [], [], { custom_tags = local.custom_tags })
+				}
+				output "asn" {
+					value = local.resolved.asn
+				}
+				output "merged" {
+					value = local.merged
+				}
+				output "rendered_asn" {
+					value = tostring(local.rendered.resolved.nxos.devices[0].configuration.asn)
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("asn", "65001"),
+					resource.TestCheckOutput("merged", "asn: \"65002\"\n"),
+					resource.TestCheckOutput("rendered_asn", "65003"),
+				),
+			},
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::render_device_configs(["nxos:\n  devices:\n    - name: leaf1\n      configuration:\n        password: !evn DEVICE_PASSWORD\n"], {}, "", {}, [], [])
+				}
+				`,
+				ExpectError: regexp.MustCompile(`unknown\s+YAML\s+tag\s+!evn`),
+			},
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::yaml_merge(["password: !evn DEVICE_PASSWORD\n"])
+				}
+				`,
+				ExpectError: regexp.MustCompile(`unknown\s+YAML\s+tag\s+!evn`),
+			},
+		},
+	})
+}
+
+func TestApplyTagMode(t *testing.T) {
+	t.Setenv("TAG_MODE_VAR", "value")
+	input := map[string]any{
+		"plain": "text",
+		"env":   "!env TAG_MODE_VAR",
+		"list":  []any{"!sha256 abc", 1},
+	}
+
+	resolved, err := applyTagMode(input, TagModeResolve)
+	if err != nil {
+		t.Fatalf("resolve: unexpected error: %v", err)
+	}
+	if resolved.(map[string]any)["env"] != "value" {
+		t.Errorf("resolve: expected 'value', got %v", resolved.(map[string]any)["env"])
+	}
+
+	preserved, err := applyTagMode(input, TagModePreserve)
+	if err != nil {
+		t.Fatalf("preserve: unexpected error: %v", err)
+	}
+	if preserved.(map[string]any)["env"] != "!env TAG_MODE_VAR" {
+		t.Errorf("preserve: expected tag to be kept, got %v", preserved.(map[string]any)["env"])
+	}
+
+	stripped, err := applyTagMode(input, TagModeStrip)
+	if err != nil {
+		t.Fatalf("strip: unexpected error: %v", err)
+	}
+	sm := stripped.(map[string]any)
+	if sm["plain"] != "text" || sm["env"] != nil || sm["list"].([]any)[0] != nil || sm["list"].([]any)[1] != 1 {
+		t.Errorf("strip: unexpected result %v", sm)
+	}
+
+	_, err = applyTagMode(input, TagModeFail)
+	if err == nil {
+		t.Fatal("fail: expected error")
+	}
+	if !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("fail: unexpected error message: %v", err)
+	}
+
+	if _, err := applyTagMode(map[string]any{"plain": "text"}, TagModeFail); err != nil {
+		t.Errorf("fail: unexpected error without tags: %v", err)
+	}
+}
+
+func TestApplyTagMode_MultiLine(t *testing.T) {
+	decoded, err := yamlDecode("secret: !age |\n  -----BEGIN AGE ENCRYPTED FILE-----\n  YWJj\n  -----END AGE ENCRYPTED FILE-----\nconfig: !yaml |\n  a: 1\n  b: 2\n")
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	stripped, err := applyTagMode(decoded, TagModeStrip)
+	if err != nil {
+		t.Fatalf("strip: unexpected error: %v", err)
+	}
+	for _, key := range []string{"secret", "config"} {
+		if v, _ := stripped.(*OrderedMap).Get(key); v != nil {
+			t.Errorf("strip: expected %s to be null, got %q", key, v)
+		}
+	}
+
+	if _, err := applyTagMode(decoded, TagModeFail); err == nil || !strings.Contains(err.Error(), "!age is not allowed") {
+		t.Errorf("fail: expected error for multi-line !age tag, got %v", err)
+	}
+
+	encoded, err := yamlEncodeTagged(decoded)
+	if err != nil {
+		t.Fatalf("preserve: %v", err)
+	}
+	if !strings.Contains(encoded, "secret: !age |") || !strings.Contains(encoded, "config: !yaml ") {
+		t.Errorf("preserve: expected multi-line values to keep their tags, got:\n%s", encoded)
+	}
+	roundTrip, err := yamlDecode(encoded)
+	if err != nil {
+		t.Fatalf("preserve: decode: %v", err)
+	}
+	for _, key := range []string{"secret", "config"} {
+		before, _ := decoded.(*OrderedMap).Get(key)
+		after, _ := roundTrip.(*OrderedMap).Get(key)
+		if before != after {
+			t.Errorf("preserve: %s did not round trip: %q != %q", key, before, after)
+		}
+	}
+}
+
+func TestYamlEncodeTagged(t *testing.T) {
+	input := "name: leaf1\npassword: !env DEVICE_PASSWORD\nbanner: !base64 \"!env BANNER\"\nnote: \"!important\"\n"
+	decoded, err := yamlDecode(input)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	encoded, err := yamlEncodeTagged(decoded)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if encoded != input {
+		t.Errorf("expected tags to round trip:\n%s\ngot:\n%s", input, encoded)
+	}
+}
+
 // Acceptance tests for the Terraform function
 
 func TestResolveYamlTagsFunction_Basic(t *testing.T) {
@@ -335,3 +661,36 @@ func TestResolveYamlTagsFunction_RoundTrip(t *testing.T) {
 		},
 	})
 }
+
+func TestResolveYamlTagsFunction_TransformTags(t *testing.T) {
+	os.Setenv("TEST_RESOLVE_BANNER", "Authorized access only")
+	defer os.Unsetenv("TEST_RESOLVE_BANNER")
+
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					decoded  = provider::utils::yaml_decode(<<-EOT
+					banner: !base64 "!env TEST_RESOLVE_BANNER"
+					key_hash: !sha256 secret
+					settings: !json '{"mtu": 9216, "enabled": true}'
+					EOT
+					)
+					resolved = provider::utils::resolve_yaml_tags(local.decoded)
+				}
+				output "test" {
+					value = jsonencode(local.resolved)
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("test", `{"banner":"QXV0aG9yaXplZCBhY2Nlc3Mgb25seQ==","key_hash":"2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b","settings":{"enabled":true,"mtu":9216}}`),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var _ function.Function = TemplateVariablesFunction{}
+
+func NewTemplateVariablesFunction() function.Function {
+	return &TemplateVariablesFunction{}
+}
+
+type TemplateVariablesFunction struct{}
+
+func (r TemplateVariablesFunction) Metadata(_ context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "template_variables"
+}
+
+func (r TemplateVariablesFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary: "List the variables and functions referenced by an HCL template",
+		MarkdownDescription: "Parse an HCL template, as used by `render_device_configs` and Terraform's `templatestring`, without evaluating it. " +
+			"Returns every variable reference (e.g. `GLOBAL.devices[0].name`) in `variables` and every called function in `functions`, both sorted and without duplicates. " +
+			"Variables declared by `for` expressions are not reported. " +
+			"If a `variables` map is passed, `undefined_variables` lists the references that do not exist in it and `unknown_functions` the functions that are not available in `render_device_configs` templates; " +
+			"otherwise both are `null`. This can be used to lint templates and to check that all template inputs exist before rendering.",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                "template",
+				MarkdownDescription: "The HCL template string to analyze.",
+			},
+		},
+		VariadicParameter: function.DynamicParameter{
+			Name:                "variables",
+			AllowNullValue:      true,
+			MarkdownDescription: "Optional map or object of the variables available to the template, used to report undefined references and unknown functions.",
+		},
+		Return: function.ObjectReturn{
+			AttributeTypes: map[string]attr.Type{
+				"variables":           types.ListType{ElemType: types.StringType},
+				"functions":           types.ListType{ElemType: types.StringType},
+				"undefined_variables": types.ListType{ElemType: types.StringType},
+				"unknown_functions":   types.ListType{ElemType: types.StringType},
+			},
+		},
+	}
+}
+
+func (r TemplateVariablesFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var tmpl string
+	var variables []types.Dynamic
+
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &tmpl, &variables))
+	if resp.Error != nil {
+		return
+	}
+
+	if len(variables) > 1 {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(fmt.Sprintf("Expected at most one variables argument, got %d", len(variables))))
+		return
+	}
+
+	var vars map[string]cty.Value
+	if len(variables) == 1 && !variables[0].IsNull() {
+		native, err := convertDynamicToNative(variables[0])
+		if err != nil {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting variables: "+err.Error()))
+			return
+		}
+		m, ok := native.(map[string]any)
+		if !ok {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting variables: must be a map or object"))
+			return
+		}
+		vars, err = nativeToCtyMap(m)
+		if err != nil {
+			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting variables: "+err.Error()))
+			return
+		}
+	}
+
+	result, err := analyzeTemplate(tmpl, vars)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error analyzing template: "+err.Error()))
+		return
+	}
+
+	resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, result))
+}
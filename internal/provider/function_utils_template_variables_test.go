@@ -0,0 +1,131 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/tfversion"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Unit tests for the analyzeTemplate helper
+
+func TestAnalyzeTemplate(t *testing.T) {
+	tmpl := `hostname ${name}
+%{ for i, intf in device.interfaces ~}
+interface ${intf.id} ${GLOBAL.devices[0].name} ${lookup(tags, "env", "")}
+%{ endfor ~}
+${upper(name)} ${include("banner")} ${myfunc(x["key"])}`
+
+	result, err := analyzeTemplate(tmpl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &templateAnalysis{
+		Variables: []string{`GLOBAL.devices[0].name`, "device.interfaces", "name", "tags", `x["key"]`},
+		Functions: []string{"include", "lookup", "myfunc", "upper"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n%+v\nexpected:\n%+v", result, expected)
+	}
+}
+
+func TestAnalyzeTemplate_Variables(t *testing.T) {
+	vars := map[string]cty.Value{
+		"name": cty.StringVal("leaf1"),
+		"device": cty.ObjectVal(map[string]cty.Value{
+			"id": cty.NumberIntVal(1),
+		}),
+	}
+
+	result, err := analyzeTemplate("${name} ${device.id} ${device.role} ${missing} ${upper(name)} ${nope(name)}", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"device.role", "missing"}; !reflect.DeepEqual(result.UndefinedVariables, expected) {
+		t.Errorf("undefined variables: expected %v, got %v", expected, result.UndefinedVariables)
+	}
+	if expected := []string{"nope"}; !reflect.DeepEqual(result.UnknownFunctions, expected) {
+		t.Errorf("unknown functions: expected %v, got %v", expected, result.UnknownFunctions)
+	}
+}
+
+func TestAnalyzeTemplate_ParseError(t *testing.T) {
+	if _, err := analyzeTemplate("${name", nil); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
+
+// Acceptance tests for the Terraform function
+
+func TestTemplateVariablesFunction_Basic(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					template = "hostname $${name} $${upper(GLOBAL.domain)} $${vrf}"
+					plain    = provider::utils::template_variables(local.template)
+					checked  = provider::utils::template_variables(local.template, {
+						name   = "leaf1"
+						GLOBAL = { domain = "example.com" }
+					})
+				}
+				output "variables" {
+					value = join(",", local.plain.variables)
+				}
+				output "functions" {
+					value = join(",", local.plain.functions)
+				}
+				output "plain_undefined_is_null" {
+					value = local.plain.undefined_variables == null
+				}
+				output "undefined" {
+					value = join(",", local.checked.undefined_variables)
+				}
+				output "unknown_functions" {
+					value = length(local.checked.unknown_functions)
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("variables", "GLOBAL.domain,name,vrf"),
+					resource.TestCheckOutput("functions", "upper"),
+					resource.TestCheckOutput("plain_undefined_is_null", "true"),
+					resource.TestCheckOutput("undefined", "vrf"),
+					resource.TestCheckOutput("unknown_functions", "0"),
+				),
+			},
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::template_variables("$${name")
+				}
+				`,
+				ExpectError: regexp.MustCompile(`Error\s+analyzing\s+template`),
+			},
+		},
+	})
+}
@@ -177,6 +177,35 @@ func TestYamlDecode_TagOnNonScalarError(t *testing.T) {
 	}
 }
 
+func TestYamlDecode_TagWithoutValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"last key", "asn: !site_asn\n", "asn: \"!site_asn \"\n"},
+		{"followed by keys", "asn: !site_asn\nvrf: !mgmt_vrf\nname: leaf1\n", "asn: \"!site_asn \"\nvrf: \"!mgmt_vrf \"\nname: leaf1\n"},
+		{"nested", "device:\n  asn: !site_asn\n  name: leaf1\nsite: dc1\n", "device:\n  asn: \"!site_asn \"\n  name: leaf1\nsite: dc1\n"},
+		{"list items", "- !site_asn\n- leaf1\n- !mgmt_vrf\n", "  - \"!site_asn \"\n  - leaf1\n  - \"!mgmt_vrf \"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := yamlDecode(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := yamlEncode(result)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if out != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, out)
+			}
+		})
+	}
+}
+
 func TestYamlDecode_EmptyDocument(t *testing.T) {
 	result, err := yamlDecode("")
 	if err != nil {
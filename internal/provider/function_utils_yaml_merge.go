@@ -41,7 +41,7 @@ func (r YamlMergeFunction) Metadata(_ context.Context, req function.MetadataRequ
 func (r YamlMergeFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
 	resp.Definition = function.Definition{
 		Summary:             "Merge a list of YAML strings",
-		MarkdownDescription: "Merge a list of YAML strings into a single YAML string, where maps are deep merged and list entries are compared against existing list entries and if all primitive values match, the entries are deep merged. YAML `!env` tags can be used to resolve values from environment variables.",
+		MarkdownDescription: "Merge a list of YAML strings into a single YAML string, where maps are deep merged and list entries are compared against existing list entries and if all primitive values match, the entries are deep merged. YAML `!env` tags can be used to resolve values from environment variables, `!age` tags and SOPS-encrypted documents are decrypted with the age identity from `SOPS_AGE_KEY` or `SOPS_AGE_KEY_FILE`. Transform tags (`!base64`, `!base64decode`, `!sha256`, `!json`, `!yaml`) can be stacked on other tags. `!ref path.to.value` tags are resolved against the merged result. User-defined tags can be declared in the `custom_tags` option, other unknown tags are reported as errors. The optional `tag_mode` option can preserve, strip or reject tags instead of resolving them. Access to environment variables can be restricted with the comma-separated `UTILS_ENV_ALLOWLIST` and `UTILS_ENV_DENYLIST` environment variables.",
 		Parameters: []function.Parameter{
 			function.ListParameter{
 				Name:                "input",
@@ -49,19 +49,37 @@ func (r YamlMergeFunction) Definition(_ context.Context, _ function.DefinitionRe
 				MarkdownDescription: "A list of YAML strings that is merged.",
 			},
 		},
+		VariadicParameter: function.DynamicParameter{
+			Name:           "options",
+			AllowNullValue: true,
+			MarkdownDescription: "An optional object with additional settings. `tag_mode` controls how YAML tags are handled: `resolve` (default) resolves them, `preserve` keeps them as YAML tags in the output, `strip` replaces tagged values with `null` and `fail` returns an error if any tag is present. " +
+				"`custom_tags` declares user-defined tags like the provider `custom_tags` attribute, e.g. `{ site_asn = { value = \"65000\" } }`.",
+		},
 		Return: function.StringReturn{},
 	}
 }
 
 func (r YamlMergeFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
 	var input []string
+	var options []types.Dynamic
 
-	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &input))
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &input, &options))
 
 	if resp.Error != nil {
 		return
 	}
 
+	opts, err := parseFunctionOptions(options, OptionTagMode, OptionCustomTags)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+	tagMode, err := optionTagMode(opts)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
+	}
+
 	// Security control: Add timeout protection for merge operations
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -76,35 +94,15 @@ func (r YamlMergeFunction) Run(ctx context.Context, req function.RunRequest, res
 		return
 	}
 
-	merged := NewOrderedMap(0)
-	for _, input := range input {
-		decoded, err := yamlDecode(input)
-		if err != nil {
-			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error reading YAML string: "+err.Error()))
-			return
-		}
-		if decoded == nil {
-			continue
-		}
-
-		resolved, err := resolveYamlTags(decoded)
-		if err != nil {
-			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error resolving YAML tags: "+err.Error()))
-			return
-		}
-
-		data, ok := resolved.(*OrderedMap)
-		if !ok {
-			resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error reading YAML string: expected a YAML mapping at the top level"))
-			return
-		}
-
-		MergeMaps(data, merged, true)
+	resolver, err := newFunctionTagResolver(opts)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Invalid options: "+err.Error()))
+		return
 	}
 
-	output, err := yamlEncode(merged)
+	output, _, err := mergeYamlDocuments(input, true, tagMode, resolver)
 	if err != nil {
-		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting results to YAML: "+err.Error()))
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError(err.Error()))
 		return
 	}
 
@@ -20,6 +20,7 @@ package provider
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
@@ -128,6 +129,188 @@ func TestYamlMergeFunction_ControlCharacters(t *testing.T) {
 	})
 }
 
+// TestYamlMergeFunction_SopsDocument verifies that SOPS-encrypted documents are
+// decrypted with the age identity from SOPS_AGE_KEY before merging.
+func TestYamlMergeFunction_SopsDocument(t *testing.T) {
+	identity := testAgeIdentity(t)
+	encrypted := testSopsDocument(t, identity)
+
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				locals {
+					encrypted = <<-EOT
+%s
+EOT
+					plain = <<-EOT
+					device:
+					  site: dc1
+					EOT
+				}
+				output "test" {
+					value = provider::utils::yaml_merge([local.encrypted, local.plain])
+				}
+				`, encrypted),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("test", "device:\n  name: leaf1\n  asn: 65001\n  enabled: true\n  users:\n    - admin\n  comment_unencrypted: plain\n  site: dc1\n"),
+				),
+			},
+		},
+	})
+}
+
+// TestYamlMergeFunction_Refs verifies that !ref tags are resolved after all
+// documents have been merged, so they see the final value.
+func TestYamlMergeFunction_Refs(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					base = <<-EOT
+					asn: 65000
+					devices:
+					  - name: leaf1
+					    asn: !ref asn
+					  - name: leaf2
+					    peer_asn: !ref devices[name=leaf1].asn
+					EOT
+					site = <<-EOT
+					asn: 65100
+					EOT
+				}
+				output "test" {
+					value = provider::utils::yaml_merge([local.base, local.site])
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("test", "asn: 65100\ndevices:\n  - name: leaf1\n    asn: 65100\n  - name: leaf2\n    peer_asn: 65100\n"),
+				),
+			},
+		},
+	})
+}
+
+func TestYamlMergeFunction_RefCycle(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					input = <<-EOT
+					a: !ref b
+					b: !ref a
+					EOT
+				}
+				output "test" {
+					value = provider::utils::yaml_merge([local.input])
+				}
+				`,
+				ExpectError: regexp.MustCompile(`reference cycle detected`),
+			},
+		},
+	})
+}
+
+func TestYamlMergeFunction_TagModes(t *testing.T) {
+	t.Setenv("TAG_MODE_TEST", "secret")
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					input = <<-EOT
+					name: leaf1
+					password: !env TAG_MODE_TEST
+					peer: !ref name
+					EOT
+				}
+				output "resolve" {
+					value = provider::utils::yaml_merge([local.input], { tag_mode = "resolve" })
+				}
+				output "preserve" {
+					value = provider::utils::yaml_merge([local.input], { tag_mode = "preserve" })
+				}
+				output "strip" {
+					value = provider::utils::yaml_merge([local.input], { tag_mode = "strip" })
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("resolve", "name: leaf1\npassword: secret\npeer: leaf1\n"),
+					resource.TestCheckOutput("preserve", "name: leaf1\npassword: !env TAG_MODE_TEST\npeer: !ref name\n"),
+					// Stripped values are null and therefore dropped when merged
+					resource.TestCheckOutput("strip", "name: leaf1\n"),
+				),
+			},
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::yaml_merge(["password: !env TAG_MODE_TEST\n"], { tag_mode = "fail" })
+				}
+				`,
+				ExpectError: regexp.MustCompile(`password: YAML tag\s+!env is not allowed`),
+			},
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::yaml_merge(["a: b\n"], { tag_mode = "ignore" })
+				}
+				`,
+				ExpectError: regexp.MustCompile(`invalid tag_mode\s+'ignore'`),
+			},
+		},
+	})
+}
+
+func TestYamlMergeFunction_EnvAllowlist(t *testing.T) {
+	t.Setenv("YAML_MERGE_ALLOWED", "ok")
+	t.Setenv("YAML_MERGE_BLOCKED", "secret")
+	t.Setenv("UTILS_ENV_ALLOWLIST", "YAML_MERGE_ALLOWED")
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::yaml_merge(["value: !env YAML_MERGE_ALLOWED\n"])
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("test", "value: ok\n"),
+				),
+			},
+			{
+				Config: `
+				output "test" {
+					value = provider::utils::yaml_merge(["value: !env YAML_MERGE_BLOCKED\n"])
+				}
+				`,
+				ExpectError: regexp.MustCompile(`YAML_MERGE_BLOCKED is blocked: it\s+does not match any allowlist pattern`),
+			},
+		},
+	})
+}
+
 func testAccFunctionUtilsYamlMerge_emptyDocs() string {
 	return `
 	locals {
@@ -0,0 +1,84 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+var _ function.Function = YamlTagsFunction{}
+
+func NewYamlTagsFunction() function.Function {
+	return &YamlTagsFunction{}
+}
+
+type YamlTagsFunction struct{}
+
+func (r YamlTagsFunction) Metadata(_ context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "yaml_tags"
+}
+
+func (r YamlTagsFunction) Definition(_ context.Context, _ function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:             "List the YAML tags in a data structure",
+		MarkdownDescription: "Recursively walk a data structure and return every YAML tag string (e.g. `!env VARNAME`) without resolving it. Each entry contains the `tag` (e.g. `!env`), its `argument` and the key `path` of the value (e.g. `devices[0].password`), sorted by path. Tags nested in a transform tag such as `!base64 \"!env BANNER\"` are listed as separate entries, tags inside a document embedded with `!yaml` at their path below the tagged value. This can be used to check that all required environment variables and secrets are available before resolving a model. This is intended to be used after `yaml_decode` which preserves unknown YAML tags as literal strings.",
+		Parameters: []function.Parameter{
+			function.DynamicParameter{
+				Name:                "input",
+				AllowNullValue:      true,
+				MarkdownDescription: "The data structure to list YAML tags of. Can be any Terraform value type.",
+			},
+		},
+		Return: function.ListReturn{
+			ElementType: types.ObjectType{
+				AttrTypes: map[string]attr.Type{
+					"tag":      types.StringType,
+					"argument": types.StringType,
+					"path":     types.StringType,
+				},
+			},
+		},
+	}
+}
+
+func (r YamlTagsFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var inputDynamic types.Dynamic
+
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &inputDynamic))
+	if resp.Error != nil {
+		return
+	}
+
+	// Security control: Add timeout protection
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// Convert Terraform Dynamic value to native Go types
+	native, err := convertDynamicToNative(inputDynamic)
+	if err != nil {
+		resp.Error = function.ConcatFuncErrors(resp.Error, function.NewFuncError("Error converting input: "+err.Error()))
+		return
+	}
+
+	resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, findYamlTags(native)))
+}
@@ -0,0 +1,153 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/tfversion"
+)
+
+// Unit tests for the findYamlTags helper
+
+func TestFindYamlTags(t *testing.T) {
+	input, err := yamlDecode(`
+name: leaf1
+password: !env DEVICE_PASSWORD
+banner: !base64 "!env BANNER"
+devices:
+  - name: spine1
+    asn: !ref global.asn
+    secret: !vault kv/spine1
+`)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	expected := []yamlTagOccurrence{
+		{Tag: "!base64", Argument: "!env BANNER", Path: "banner"},
+		{Tag: "!env", Argument: "BANNER", Path: "banner"},
+		{Tag: "!ref", Argument: "global.asn", Path: "devices[0].asn"},
+		{Tag: "!vault", Argument: "kv/spine1", Path: "devices[0].secret"},
+		{Tag: "!env", Argument: "DEVICE_PASSWORD", Path: "password"},
+	}
+	if got := findYamlTags(input); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected result:\n%+v\nexpected:\n%+v", got, expected)
+	}
+}
+
+func TestFindYamlTags_MultiLineAndEmbedded(t *testing.T) {
+	input, err := yamlDecode(`
+secret: !age |
+  -----BEGIN AGE ENCRYPTED FILE-----
+  YWJj
+  -----END AGE ENCRYPTED FILE-----
+config: !yaml |
+  user: admin
+  password: !env DEVICE_PASSWORD
+  peers:
+    - asn: !ref global.asn
+other: !yaml "!env CONFIG"
+`)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	expected := []yamlTagOccurrence{
+		{Tag: "!yaml", Argument: "user: admin\npassword: !env DEVICE_PASSWORD\npeers:\n  - asn: !ref global.asn\n", Path: "config"},
+		{Tag: "!env", Argument: "DEVICE_PASSWORD", Path: "config.password"},
+		{Tag: "!ref", Argument: "global.asn", Path: "config.peers[0].asn"},
+		{Tag: "!yaml", Argument: "!env CONFIG", Path: "other"},
+		{Tag: "!env", Argument: "CONFIG", Path: "other"},
+		{Tag: "!age", Argument: "-----BEGIN AGE ENCRYPTED FILE-----\nYWJj\n-----END AGE ENCRYPTED FILE-----\n", Path: "secret"},
+	}
+	if got := findYamlTags(input); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected result:\n%+v\nexpected:\n%+v", got, expected)
+	}
+}
+
+func TestFindYamlTags_NoTags(t *testing.T) {
+	got := findYamlTags(map[string]any{"name": "leaf1", "asn": 65001, "note": "important!", "bang": "!"})
+	if got == nil || len(got) != 0 {
+		t.Errorf("expected empty list, got %+v", got)
+	}
+}
+
+// Acceptance tests for the Terraform function
+
+func TestYamlTagsFunction_Basic(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				locals {
+					yaml_input = <<-EOT
+					name: leaf1
+					password: !env DEVICE_PASSWORD
+					users:
+					  - name: admin
+					    key: !env ADMIN_KEY
+					EOT
+					tags = provider::utils::yaml_tags(provider::utils::yaml_decode(local.yaml_input))
+				}
+				output "count" {
+					value = length(local.tags)
+				}
+				output "env_vars" {
+					value = join(",", [for t in local.tags : t.argument if t.tag == "!env"])
+				}
+				output "first_path" {
+					value = local.tags[0].path
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("count", "2"),
+					resource.TestCheckOutput("env_vars", "DEVICE_PASSWORD,ADMIN_KEY"),
+					resource.TestCheckOutput("first_path", "password"),
+				),
+			},
+		},
+	})
+}
+
+func TestYamlTagsFunction_Null(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_8_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				output "test" {
+					value = length(provider::utils::yaml_tags(null))
+				}
+				`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckOutput("test", "0"),
+				),
+			},
+		},
+	})
+}
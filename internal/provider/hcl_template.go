@@ -26,6 +26,7 @@ import (
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/ext/tryfunc"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
+	ctyyaml "github.com/zclconf/go-cty-yaml"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
 	"github.com/zclconf/go-cty/cty/function/stdlib"
@@ -34,24 +35,37 @@ import (
 // renderHCLTemplate parses and evaluates an HCL template string with the given variables.
 // This uses the same HCL library that Terraform's templatestring() uses internally.
 func renderHCLTemplate(tmpl string, vars map[string]cty.Value) (string, error) {
+	return renderHCLTemplateWithFunctions(tmpl, vars, hclTemplateFunctions(), nil)
+}
+
+// renderHCLTemplateWithFunctions is renderHCLTemplate with a custom function map.
+// If limits is not nil, funcs must have been prepared with limits.install.
+func renderHCLTemplateWithFunctions(tmpl string, vars map[string]cty.Value, funcs map[string]function.Function, limits *templateLimits) (string, error) {
 	expr, diags := hclsyntax.ParseTemplate([]byte(tmpl), "template", hcl.Pos{Line: 1, Column: 1})
 	if diags.HasErrors() {
 		return "", fmt.Errorf("parsing template: %s", diags.Error())
 	}
+	limits.instrument(expr)
 
 	ctx := &hcl.EvalContext{
 		Variables: vars,
-		Functions: hclTemplateFunctions(),
+		Functions: funcs,
 	}
 
 	val, diags := expr.Value(ctx)
+	if err := limits.error(); err != nil {
+		return "", err
+	}
 	if diags.HasErrors() {
-		return "", fmt.Errorf("evaluating template: %s", diags.Error())
+		return "", fmt.Errorf("evaluating template: %w", diags)
 	}
 
 	if val.Type() != cty.String {
 		return "", fmt.Errorf("template result is %s, not string", val.Type().FriendlyName())
 	}
+	if err := limits.checkOutput(len(val.AsString())); err != nil {
+		return "", err
+	}
 
 	return val.AsString(), nil
 }
@@ -61,47 +75,91 @@ func renderHCLTemplate(tmpl string, vars map[string]cty.Value) (string, error) {
 // - Pure expressions like "${count}" may return int, bool, etc.
 // - Interpolated strings like "prefix-${name}" always return string.
 func renderHCLTemplateValue(tmpl string, vars map[string]cty.Value) (any, error) {
+	return renderHCLTemplateValueWithFunctions(tmpl, vars, hclTemplateFunctions(), nil)
+}
+
+// renderHCLTemplateValueWithFunctions is renderHCLTemplateValue with a custom function
+// map. If limits is not nil, funcs must have been prepared with limits.install.
+func renderHCLTemplateValueWithFunctions(tmpl string, vars map[string]cty.Value, funcs map[string]function.Function, limits *templateLimits) (any, error) {
 	expr, diags := hclsyntax.ParseTemplate([]byte(tmpl), "template", hcl.Pos{Line: 1, Column: 1})
 	if diags.HasErrors() {
 		return nil, fmt.Errorf("parsing template: %s", diags.Error())
 	}
+	limits.instrument(expr)
 
 	ctx := &hcl.EvalContext{
 		Variables: vars,
-		Functions: hclTemplateFunctions(),
+		Functions: funcs,
 	}
 
 	val, diags := expr.Value(ctx)
+	if err := limits.error(); err != nil {
+		return nil, err
+	}
 	if diags.HasErrors() {
 		return nil, fmt.Errorf("evaluating template: %s", diags.Error())
 	}
+	if val.IsKnown() && val.Type() == cty.String && !val.IsNull() {
+		if err := limits.checkOutput(len(val.AsString())); err != nil {
+			return nil, err
+		}
+	}
 
-	return ctyToNative(val), nil
+	native, err := ctyToNative(val)
+	if err != nil {
+		return nil, fmt.Errorf("converting template result: %w", err)
+	}
+	return native, nil
 }
 
-// ctyToNative converts a cty.Value to a native Go value.
-func ctyToNative(val cty.Value) any {
+// ctyToNative converts a cty.Value to a native Go value. Lists, sets and tuples
+// become []any and maps and objects become map[string]any, recursively.
+func ctyToNative(val cty.Value) (any, error) {
 	if val.IsNull() {
-		return nil
+		return nil, nil
+	}
+	if !val.IsKnown() {
+		return nil, fmt.Errorf("value is unknown")
 	}
 	ty := val.Type()
 	switch {
 	case ty == cty.String:
-		return val.AsString()
+		return val.AsString(), nil
 	case ty == cty.Number:
 		bf := val.AsBigFloat()
 		if bf.IsInt() {
 			if i, acc := bf.Int64(); acc == big.Exact {
-				return i
+				return i, nil
 			}
 		}
 		f, _ := bf.Float64()
-		return f
+		return f, nil
 	case ty == cty.Bool:
-		return val.True()
+		return val.True(), nil
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		result := make([]any, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			native, err := ctyToNative(v)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", len(result), err)
+			}
+			result = append(result, native)
+		}
+		return result, nil
+	case ty.IsMapType() || ty.IsObjectType():
+		result := make(map[string]any, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			native, err := ctyToNative(v)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k.AsString(), err)
+			}
+			result[k.AsString()] = native
+		}
+		return result, nil
 	default:
-		// For complex types, fall back to string representation
-		return val.AsString()
+		return nil, fmt.Errorf("unsupported type %s", ty.FriendlyName())
 	}
 }
 
@@ -246,6 +304,35 @@ func hclTemplateFunctions() map[string]function.Function {
 		"sum":         sumFunc,
 		"base64encode": base64EncodeFunc,
 		"base64decode": base64DecodeFunc,
+
+		// Network functions
+		"cidrcontains":  cidrContainsFunc,
+		"cidrhost":      cidrHostFunc,
+		"cidrnetmask":   cidrNetmaskFunc,
+		"cidrprefixlen": cidrPrefixLenFunc,
+		"cidrsubnet":    cidrSubnetFunc,
+		"cidrsubnets":   cidrSubnetsFunc,
+		"ipexpand":      ipExpandFunc,
+		"ipversion":     ipVersionFunc,
+
+		// Provider normalize functions
+		"normalize_bgp_rd": normalizeBgpRdTemplateFunc,
+		"normalize_bgp_rt": normalizeBgpRtTemplateFunc,
+		"normalize_mac":    normalizeMacTemplateFunc,
+		"normalize_mask":   normalizeMaskTemplateFunc,
+		"normalize_vlans":  normalizeVlansTemplateFunc,
+
+		// Hashing, UUID and encoding functions
+		"base64sha256": base64Sha256Func,
+		"base64sha512": base64Sha512Func,
+		"md5":          md5Func,
+		"sha1":         sha1Func,
+		"sha256":       sha256Func,
+		"sha512":       sha512Func,
+		"urlencode":    urlEncodeFunc,
+		"uuidv5":       uuidV5Func,
+		"yamldecode":   ctyyaml.YAMLDecodeFunc,
+		"yamlencode":   ctyyaml.YAMLEncodeFunc,
 	}
 }
 
@@ -0,0 +1,98 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Hashing, UUID and URL encoding functions for HCL templates. They follow the
+// behavior of the Terraform built-in functions of the same name and only depend
+// on their arguments, so rendering stays deterministic.
+
+var md5Func = makeStringHashFunc(md5.New, hex.EncodeToString)
+var sha1Func = makeStringHashFunc(sha1.New, hex.EncodeToString)
+var sha256Func = makeStringHashFunc(sha256.New, hex.EncodeToString)
+var sha512Func = makeStringHashFunc(sha512.New, hex.EncodeToString)
+var base64Sha256Func = makeStringHashFunc(sha256.New, base64.StdEncoding.EncodeToString)
+var base64Sha512Func = makeStringHashFunc(sha512.New, base64.StdEncoding.EncodeToString)
+
+// makeStringHashFunc returns a function hashing its string argument with hf and
+// encoding the digest with enc.
+func makeStringHashFunc(hf func() hash.Hash, enc func([]byte) string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "str", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			h := hf()
+			h.Write([]byte(args[0].AsString()))
+			return cty.StringVal(enc(h.Sum(nil))), nil
+		},
+	})
+}
+
+// uuidV5Namespaces maps the namespace keywords accepted by uuidv5 to the RFC 4122 namespaces.
+var uuidV5Namespaces = map[string]uuid.UUID{
+	"dns":  uuid.NameSpaceDNS,
+	"url":  uuid.NameSpaceURL,
+	"oid":  uuid.NameSpaceOID,
+	"x500": uuid.NameSpaceX500,
+}
+
+var uuidV5Func = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "namespace", Type: cty.String},
+		{Name: "name", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		ns := args[0].AsString()
+		namespace, ok := uuidV5Namespaces[ns]
+		if !ok {
+			parsed, err := uuid.Parse(ns)
+			if err != nil {
+				return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "uuidv5() doesn't support namespace %s (%v)", ns, err)
+			}
+			namespace = parsed
+		}
+		return cty.StringVal(uuid.NewSHA1(namespace, []byte(args[1].AsString())).String()), nil
+	},
+})
+
+var urlEncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "str", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(url.QueryEscape(args[0].AsString())), nil
+	},
+})
@@ -0,0 +1,287 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+
+	"github.com/apparentlymart/go-cidr/cidr"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// Network functions for HCL templates. cidrhost, cidrnetmask, cidrsubnet and
+// cidrsubnets follow the behavior of the Terraform built-in functions of the same
+// name and work with both IPv4 and IPv6 prefixes.
+
+var cidrHostFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "hostnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var hostNum *big.Int
+		if err := gocty.FromCtyValue(args[1], &hostNum); err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(1, err)
+		}
+		network, err := parseTemplateCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+		}
+		ip, err := cidr.HostBig(network, hostNum)
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(1, err)
+		}
+		return cty.StringVal(ip.String()), nil
+	},
+})
+
+var cidrNetmaskFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		network, err := parseTemplateCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+		}
+		if network.IP.To4() == nil {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "IPv6 addresses cannot have a netmask: %s", args[0].AsString())
+		}
+		return cty.StringVal(net.IP(network.Mask).String()), nil
+	},
+})
+
+var cidrSubnetFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "newbits", Type: cty.Number},
+		{Name: "netnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var newbits int
+		if err := gocty.FromCtyValue(args[1], &newbits); err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(1, err)
+		}
+		var netnum *big.Int
+		if err := gocty.FromCtyValue(args[2], &netnum); err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(2, err)
+		}
+		network, err := parseTemplateCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+		}
+		subnet, err := cidr.SubnetBig(network, newbits, netnum)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		return cty.StringVal(subnet.String()), nil
+	},
+})
+
+var cidrSubnetsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+	},
+	VarParam: &function.Parameter{
+		Name: "newbits",
+		Type: cty.Number,
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		network, err := parseTemplateCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.List(cty.String)), function.NewArgError(0, err)
+		}
+		startPrefixLen, _ := network.Mask.Size()
+
+		newbitsArgs := args[1:]
+		if len(newbitsArgs) == 0 {
+			return cty.ListValEmpty(cty.String), nil
+		}
+
+		var firstLength int
+		if err := gocty.FromCtyValue(newbitsArgs[0], &firstLength); err != nil {
+			return cty.UnknownVal(cty.List(cty.String)), function.NewArgError(1, err)
+		}
+		current, _ := cidr.PreviousSubnet(network, firstLength+startPrefixLen)
+
+		subnets := make([]cty.Value, len(newbitsArgs))
+		for i, arg := range newbitsArgs {
+			var length int
+			if err := gocty.FromCtyValue(arg, &length); err != nil {
+				return cty.UnknownVal(cty.List(cty.String)), function.NewArgError(i+1, err)
+			}
+			if length < 1 {
+				return cty.UnknownVal(cty.List(cty.String)), function.NewArgErrorf(i+1, "must extend prefix by at least one bit")
+			}
+			// Like Terraform, limit each extension to 32 bits so results do not
+			// depend on the platform integer size.
+			if length > 32 {
+				return cty.UnknownVal(cty.List(cty.String)), function.NewArgErrorf(i+1, "may not extend prefix by more than 32 bits")
+			}
+			length += startPrefixLen
+			if length > len(network.IP)*8 {
+				return cty.UnknownVal(cty.List(cty.String)), function.NewArgErrorf(i+1, "would extend prefix to %d bits, which is too long for an %s address", length, ipFamily(network.IP))
+			}
+
+			next, rollover := cidr.NextSubnet(current, length)
+			if rollover || !network.Contains(next.IP) {
+				// Running out of suffix bits would make NextSubnet continue into the
+				// prefix bits, allocating subnets outside of the given prefix.
+				return cty.UnknownVal(cty.List(cty.String)), function.NewArgErrorf(i+1, "not enough remaining address space for a subnet with a prefix of %d bits after %s", length, current.String())
+			}
+			current = next
+			subnets[i] = cty.StringVal(current.String())
+		}
+		return cty.ListVal(subnets), nil
+	},
+})
+
+// cidrContainsFunc reports whether an address or prefix lies within a prefix.
+var cidrContainsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "address", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		network, err := parseTemplateCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), function.NewArgError(0, err)
+		}
+		addr := args[1].AsString()
+		if strings.Contains(addr, "/") {
+			other, err := parseTemplateCIDR(addr)
+			if err != nil {
+				return cty.UnknownVal(cty.Bool), function.NewArgError(1, err)
+			}
+			networkLen, _ := network.Mask.Size()
+			otherLen, _ := other.Mask.Size()
+			return cty.BoolVal(network.Contains(other.IP) && otherLen >= networkLen && len(other.IP) == len(network.IP)), nil
+		}
+		ip, err := parseTemplateIP(addr)
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), function.NewArgError(1, err)
+		}
+		return cty.BoolVal(network.Contains(ip)), nil
+	},
+})
+
+// cidrPrefixLenFunc returns the prefix length of a prefix, e.g. 64 for "2001:db8::/64".
+var cidrPrefixLenFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		network, err := parseTemplateCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.Number), function.NewArgError(0, err)
+		}
+		ones, _ := network.Mask.Size()
+		return cty.NumberIntVal(int64(ones)), nil
+	},
+})
+
+// ipVersionFunc returns 4 or 6 for an address or prefix.
+var ipVersionFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "address", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		addr := args[0].AsString()
+		var ip net.IP
+		if strings.Contains(addr, "/") {
+			network, err := parseTemplateCIDR(addr)
+			if err != nil {
+				return cty.UnknownVal(cty.Number), function.NewArgError(0, err)
+			}
+			ip = network.IP
+		} else {
+			parsed, err := parseTemplateIP(addr)
+			if err != nil {
+				return cty.UnknownVal(cty.Number), function.NewArgError(0, err)
+			}
+			ip = parsed
+		}
+		if ip.To4() != nil {
+			return cty.NumberIntVal(4), nil
+		}
+		return cty.NumberIntVal(6), nil
+	},
+})
+
+// ipExpandFunc returns the fully expanded form of an IPv6 address, e.g.
+// "2001:0db8:0000:0000:0000:0000:0000:0001" for "2001:db8::1". IPv4 addresses
+// are returned in dotted-decimal form.
+var ipExpandFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "address", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		ip, err := parseTemplateIP(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return cty.StringVal(ip4.String()), nil
+		}
+		groups := make([]string, 8)
+		for i := range groups {
+			groups[i] = fmt.Sprintf("%02x%02x", ip[2*i], ip[2*i+1])
+		}
+		return cty.StringVal(strings.Join(groups, ":")), nil
+	},
+})
+
+// parseTemplateCIDR parses a prefix in CIDR notation and returns its network.
+// IPv4 networks use the 4-byte representation.
+func parseTemplateCIDR(s string) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR expression: %s", err)
+	}
+	return network, nil
+}
+
+// parseTemplateIP parses a single IPv4 or IPv6 address.
+func parseTemplateIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	return ip, nil
+}
+
+// ipFamily names the address family of ip for error messages.
+func ipFamily(ip net.IP) string {
+	if len(ip) == net.IPv4len {
+		return "IPv4"
+	}
+	return "IPv6"
+}
@@ -0,0 +1,156 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Template versions of the normalize_* provider functions. They share the parsing
+// and validation code of the provider functions and return the same results.
+
+var normalizeVlansTemplateFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "input", Type: cty.DynamicPseudoType, AllowNull: true, AllowDynamicType: true},
+		{Name: "format", Type: cty.String},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		if !args[1].IsKnown() {
+			return cty.DynamicPseudoType, nil
+		}
+		if args[1].AsString() == FormatList {
+			return cty.List(cty.Number), nil
+		}
+		return cty.String, nil
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		format := args[1].AsString()
+		if !ValidVlanFormats[format] {
+			return cty.NilVal, function.NewArgErrorf(1, "Invalid format '%s'. Must be '%s', '%s', or '%s'", format, FormatString, FormatStringNxos, FormatList)
+		}
+
+		input, err := ctyToNative(args[0])
+		if err != nil {
+			return cty.NilVal, function.NewArgError(0, err)
+		}
+		vlanSet, err := parseVlanSet(input)
+		if err != nil {
+			return cty.NilVal, function.NewArgError(0, err)
+		}
+		vlans := sortedVlanIDs(vlanSet)
+
+		if format == FormatList {
+			if len(vlans) == 0 {
+				return cty.ListValEmpty(cty.Number), nil
+			}
+			values := make([]cty.Value, len(vlans))
+			for i, vlan := range vlans {
+				values[i] = cty.NumberIntVal(int64(vlan))
+			}
+			return cty.ListVal(values), nil
+		}
+		return cty.StringVal(formatVlanIDs(vlans, format)), nil
+	},
+})
+
+var normalizeMacTemplateFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "mac", Type: cty.String},
+		{Name: "format", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		format := args[1].AsString()
+		if !ValidMacFormats[format] {
+			return cty.NilVal, function.NewArgErrorf(1, "Invalid format '%s'. Must be one of: 'dotted', 'colon', 'dash'", format)
+		}
+		cleaned, err := cleanMacAddress(args[0].AsString())
+		if err != nil {
+			return cty.NilVal, function.NewArgError(0, err)
+		}
+		return cty.StringVal(formatMacAddress(cleaned, format)), nil
+	},
+})
+
+var normalizeMaskTemplateFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "mask", Type: cty.Number},
+		{Name: "format", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		format := args[1].AsString()
+		if !ValidMaskFormats[format] {
+			return cty.NilVal, function.NewArgErrorf(1, "Invalid format '%s'. Must be '%s'", format, FormatDottedDecimal)
+		}
+		mask, err := maskPrefix(args[0].AsBigFloat())
+		if err != nil {
+			return cty.NilVal, function.NewArgError(0, err)
+		}
+		return cty.StringVal(convertPrefixToDottedDecimal(mask)), nil
+	},
+})
+
+var normalizeBgpRdTemplateFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "value", Type: cty.String},
+	},
+	Type: function.StaticReturnType(bgpRdRtObjectType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		format, asNumber, assignedNumber, ipv4Address, err := normalizeBgpRd(args[0].AsString())
+		if err != nil {
+			return cty.NilVal, function.NewArgError(0, err)
+		}
+		return bgpRdRtObject(format, asNumber, assignedNumber, ipv4Address), nil
+	},
+})
+
+var normalizeBgpRtTemplateFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "value", Type: cty.String},
+	},
+	Type: function.StaticReturnType(bgpRdRtObjectType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		format, asNumber, assignedNumber, ipv4Address, err := normalizeBgpRt(args[0].AsString())
+		if err != nil {
+			return cty.NilVal, function.NewArgError(0, err)
+		}
+		return bgpRdRtObject(format, asNumber, assignedNumber, ipv4Address), nil
+	},
+})
+
+// bgpRdRtObjectType is the result type of the normalize_bgp_rd and
+// normalize_bgp_rt template functions.
+var bgpRdRtObjectType = cty.Object(map[string]cty.Type{
+	"format":          cty.String,
+	"as_number":       cty.Number,
+	"assigned_number": cty.Number,
+	"ipv4_address":    cty.String,
+})
+
+// bgpRdRtObject builds the result object of the normalize_bgp_rd and
+// normalize_bgp_rt template functions.
+func bgpRdRtObject(format string, asNumber, assignedNumber int64, ipv4Address string) cty.Value {
+	return cty.ObjectVal(map[string]cty.Value{
+		"format":          cty.StringVal(format),
+		"as_number":       cty.NumberIntVal(asNumber),
+		"assigned_number": cty.NumberIntVal(assignedNumber),
+		"ipv4_address":    cty.StringVal(ipv4Address),
+	})
+}
@@ -18,6 +18,7 @@
 package provider
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/zclconf/go-cty/cty"
@@ -312,3 +313,211 @@ func TestRenderHCLTemplate_NativeToCtyIntegration(t *testing.T) {
 		t.Fatalf("expected %q, got %q", expected, result)
 	}
 }
+
+func TestRenderHCLTemplate_NetworkFunctions(t *testing.T) {
+	vars := map[string]cty.Value{
+		"pool":      cty.StringVal("10.1.0.0/16"),
+		"pool6":     cty.StringVal("2001:db8::/48"),
+		"DEVICE_ID": cty.NumberIntVal(11),
+	}
+	tests := []struct {
+		tmpl     string
+		expected string
+	}{
+		{`${cidrhost(pool, DEVICE_ID)}`, "10.1.0.11"},
+		{`${cidrhost(pool, -2)}`, "10.1.255.254"},
+		{`${cidrhost(pool6, DEVICE_ID)}`, "2001:db8::b"},
+		{`${cidrnetmask("10.1.2.0/23")}`, "255.255.254.0"},
+		{`${cidrsubnet(pool, 8, DEVICE_ID)}`, "10.1.11.0/24"},
+		{`${cidrsubnet(pool6, 16, 1)}`, "2001:db8:0:1::/64"},
+		{`${join(",", cidrsubnets(pool, 8, 4, 8))}`, "10.1.0.0/24,10.1.16.0/20,10.1.32.0/24"},
+		{`${length(cidrsubnets(pool))}`, "0"},
+		{`${cidrcontains(pool, "10.1.200.1")}`, "true"},
+		{`${cidrcontains(pool, "10.2.0.1")}`, "false"},
+		{`${cidrcontains(pool, "10.1.4.0/24")}`, "true"},
+		{`${cidrcontains("10.1.4.0/24", pool)}`, "false"},
+		{`${cidrcontains(pool6, "2001:db8:0:ff::1")}`, "true"},
+		{`${cidrprefixlen(pool6)}`, "48"},
+		{`${ipversion("10.0.0.1")}`, "4"},
+		{`${ipversion(pool6)}`, "6"},
+		{`${ipexpand("2001:db8::1")}`, "2001:0db8:0000:0000:0000:0000:0000:0001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			// Prefix the template so non-string results are interpolated
+			result, err := renderHCLTemplate("r="+tt.tmpl, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != "r="+tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRenderHCLTemplate_NetworkFunctionErrors(t *testing.T) {
+	tests := []string{
+		`${cidrhost("10.0.0.0/30", 4)}`,
+		`${cidrhost("not-a-cidr", 1)}`,
+		`${cidrnetmask("2001:db8::/64")}`,
+		`${cidrsubnet("10.0.0.0/30", 4, 0)}`,
+		`${cidrsubnets("10.0.0.0/24", 1, 1, 1)}`,
+		`${cidrsubnets("10.0.0.0/24", 0)}`,
+		`${cidrcontains("10.0.0.0/24", "10.0.0")}`,
+		`${ipversion("bogus")}`,
+	}
+	for _, tmpl := range tests {
+		t.Run(tmpl, func(t *testing.T) {
+			if _, err := renderHCLTemplate(tmpl, map[string]cty.Value{}); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestRenderHCLTemplate_NormalizeFunctions(t *testing.T) {
+	vars := map[string]cty.Value{
+		"vlans": cty.ObjectVal(map[string]cty.Value{
+			"ids": cty.TupleVal([]cty.Value{cty.NumberIntVal(1), cty.NumberIntVal(2), cty.NumberIntVal(5)}),
+			"ranges": cty.TupleVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{"from": cty.NumberIntVal(10), "to": cty.NumberIntVal(12)}),
+			}),
+		}),
+	}
+	tests := []struct {
+		tmpl     string
+		expected string
+	}{
+		{`${normalize_vlans(vlans, "string")}`, "1,2,5,10-12"},
+		{`${normalize_vlans(vlans, "string-nxos")}`, "1-2,5,10-12"},
+		{`${join(",", normalize_vlans(vlans, "list"))}`, "1,2,5,10,11,12"},
+		{`${normalize_vlans({ ids = [100, 101] }, "string")}`, "100,101"},
+		{`${normalize_vlans(null, "string")}`, ""},
+		{`${normalize_mac("00:11:22:AA:BB:CC", "dotted")}`, "0011.22aa.bbcc"},
+		{`${normalize_mask(24, "dotted-decimal")}`, "255.255.255.0"},
+		{`${normalize_bgp_rd("65000:100").format}`, "two_byte_as"},
+		{`${normalize_bgp_rd("192.168.1.1:5").ipv4_address}`, "192.168.1.1"},
+		{`${normalize_bgp_rt("4200000001:7").as_number}`, "4200000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			result, err := renderHCLTemplate("r="+tt.tmpl, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != "r="+tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRenderHCLTemplate_NormalizeFunctionErrors(t *testing.T) {
+	tests := []string{
+		`${normalize_vlans({ ids = [4095] }, "string")}`,
+		`${normalize_vlans({ ranges = [{ from = 20, to = 10 }] }, "string")}`,
+		`${normalize_vlans({ ids = [1] }, "bogus")}`,
+		`${normalize_vlans("1-10", "string")}`,
+		`${normalize_vlans({ ids = [1.5] }, "string")}`,
+		`${normalize_mac("00:11:22", "colon")}`,
+		`${normalize_mask(33, "dotted-decimal")}`,
+		`${normalize_mask(24.7, "dotted-decimal")}`,
+		`${normalize_bgp_rd("65000")}`,
+		`${normalize_bgp_rt("0:1")}`,
+	}
+	for _, tmpl := range tests {
+		t.Run(tmpl, func(t *testing.T) {
+			if _, err := renderHCLTemplate(tmpl, map[string]cty.Value{}); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestCtyToNative_Structured(t *testing.T) {
+	val := cty.ObjectVal(map[string]cty.Value{
+		"servers": cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"ports":   cty.SetVal([]cty.Value{cty.NumberIntVal(22)}),
+		"mixed":   cty.TupleVal([]cty.Value{cty.StringVal("x"), cty.True, cty.NullVal(cty.String)}),
+		"tags":    cty.MapVal(map[string]cty.Value{"env": cty.StringVal("prod")}),
+		"ratio":   cty.NumberFloatVal(0.5),
+	})
+
+	result, err := ctyToNative(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"servers": []any{"a", "b"},
+		"ports":   []any{int64(22)},
+		"mixed":   []any{"x", true, nil},
+		"tags":    map[string]any{"env": "prod"},
+		"ratio":   0.5,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, result)
+	}
+}
+
+func TestCtyToNative_Unknown(t *testing.T) {
+	_, err := ctyToNative(cty.ListVal([]cty.Value{cty.UnknownVal(cty.String)}))
+	if err == nil {
+		t.Fatal("expected error for unknown value")
+	}
+}
+
+func TestRenderHCLTemplateValue_Structured(t *testing.T) {
+	vars := map[string]cty.Value{
+		"names": cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+	}
+	result, err := renderHCLTemplateValue("${{ for n in names : n => upper(n) }}", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"a": "A", "b": "B"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, result)
+	}
+}
+
+func TestRenderHCLTemplate_HashFunctions(t *testing.T) {
+	vars := map[string]cty.Value{
+		"config": cty.ObjectVal(map[string]cty.Value{
+			"name":  cty.StringVal("leaf1"),
+			"vlans": cty.TupleVal([]cty.Value{cty.NumberIntVal(10), cty.NumberIntVal(20)}),
+		}),
+	}
+	tests := []struct {
+		tmpl     string
+		expected string
+	}{
+		{`${md5("hello world")}`, "5eb63bbbe01eeed093cb22bb8f5acdc3"},
+		{`${sha1("hello world")}`, "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed"},
+		{`${sha256("hello world")}`, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+		{`${sha512("")}`, "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"},
+		{`${base64sha256("hello world")}`, "uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek="},
+		{`${uuidv5("dns", "leaf1.example.com")}`, "8635e435-1958-5b86-8de6-d1d5ba73fc68"},
+		{`${uuidv5("6ba7b811-9dad-11d1-80b4-00c04fd430c8", "https://example.com")}`, "4fd35a71-71ef-5a55-a9d9-aa75c889a6d0"},
+		{`${urlencode("a b&c=d/é")}`, "a+b%26c%3Dd%2F%C3%A9"},
+		{`${yamlencode(config)}`, "\"name\": \"leaf1\"\n\"vlans\":\n- 10\n- 20\n"},
+		{`${yamldecode("a: [1, 2]").a[1]}`, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			result, err := renderHCLTemplate("r="+tt.tmpl, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != "r="+tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRenderHCLTemplate_UuidV5InvalidNamespace(t *testing.T) {
+	if _, err := renderHCLTemplate(`${uuidv5("bogus", "x")}`, map[string]cty.Value{}); err == nil {
+		t.Fatal("expected error for invalid namespace")
+	}
+}
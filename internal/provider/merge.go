@@ -83,6 +83,85 @@ func mapLen(m any) int {
 // For *OrderedMap: existing keys update in-place (first-doc-wins ordering), new keys append.
 // For map[string]any: standard unordered merge.
 func MergeMaps(src, dst any, deduplicate bool) any {
+	return mergeMapsTraced(src, dst, deduplicate, nil, "", "")
+}
+
+// mergeTrace records where the list items of a merge source end up in the
+// destination, keyed by their path in the source, e.g. "ethernets[0]" may be
+// merged into "ethernets[1]". A nil *mergeTrace records nothing.
+type mergeTrace struct {
+	landed map[string]string
+}
+
+func newMergeTrace() *mergeTrace {
+	return &mergeTrace{landed: map[string]string{}}
+}
+
+// key returns path extended by key, or "" if nothing is recorded.
+func (t *mergeTrace) key(path, key string) string {
+	if t == nil {
+		return ""
+	}
+	return appendKeyPath(path, key)
+}
+
+// index returns path extended by index, or "" if nothing is recorded.
+func (t *mergeTrace) index(path string, index int) string {
+	if t == nil {
+		return ""
+	}
+	return appendIndexPath(path, index)
+}
+
+// record records that the source list item at srcPath ended up at dstPath.
+func (t *mergeTrace) record(srcPath, dstPath string) {
+	if t != nil && srcPath != dstPath {
+		t.landed[srcPath] = dstPath
+	}
+}
+
+// appended records that the items of the source list at srcPath were appended
+// to the destination list at dstPath, which had offset items before.
+func (t *mergeTrace) appended(srcPath, dstPath string, offset, count int) {
+	if t == nil {
+		return
+	}
+	for i := 0; i < count; i++ {
+		t.record(appendIndexPath(srcPath, i), appendIndexPath(dstPath, offset+i))
+	}
+}
+
+// destination returns the path in the merge destination of a source path.
+func (t *mergeTrace) destination(path string) string {
+	if t == nil || len(t.landed) == 0 {
+		return path
+	}
+	segments, err := parseRefPath(path)
+	if err != nil {
+		return path
+	}
+	src, dst := "", ""
+	for _, seg := range segments {
+		switch seg.kind {
+		case refSegmentKey:
+			src = appendKeyPath(src, seg.key)
+			dst = appendKeyPath(dst, seg.key)
+		case refSegmentIndex:
+			src = appendIndexPath(src, seg.index)
+			dst = appendIndexPath(dst, seg.index)
+			if landed, ok := t.landed[src]; ok {
+				dst = landed
+			}
+		default:
+			return path
+		}
+	}
+	return dst
+}
+
+// mergeMapsTraced is MergeMaps recording list item positions in trace, where
+// srcPath and dstPath are the paths of src and dst.
+func mergeMapsTraced(src, dst any, deduplicate bool, trace *mergeTrace, srcPath, dstPath string) any {
 	mapForEach(src, func(key string, sValue any) {
 		if sValue == nil {
 			return
@@ -93,24 +172,20 @@ func MergeMaps(src, dst any, deduplicate bool) any {
 		} else {
 			srcMap, srcIsMap := asMap(sValue)
 			dstMap, dstIsMap := asMap(dValue)
+			srcKeyPath, dstKeyPath := trace.key(srcPath, key), trace.key(dstPath, key)
 			if srcIsMap && dstIsMap {
-				mapSet(dst, key, MergeMaps(srcMap, dstMap, deduplicate))
+				mapSet(dst, key, mergeMapsTraced(srcMap, dstMap, deduplicate, trace, srcKeyPath, dstKeyPath))
 				return
 			}
 
 			if sv, ok := sValue.([]any); ok {
 				if dv, ok := dValue.([]any); ok {
-					if deduplicate {
-						if len(sv) == 0 || len(dv) == 0 {
-							mapSet(dst, key, append(dv, sv...))
-						} else if hasDuplicatesInList(sv) || hasDuplicatesInList(dv) {
-							mapSet(dst, key, append(dv, sv...))
-						} else {
-							merged := dv
-							mergeListItemsIndexed(sv, &merged, deduplicate)
-							mapSet(dst, key, merged)
-						}
+					if deduplicate && len(sv) > 0 && len(dv) > 0 && !hasDuplicatesInList(sv) && !hasDuplicatesInList(dv) {
+						merged := dv
+						mergeListItemsTraced(sv, &merged, deduplicate, trace, srcKeyPath, dstKeyPath)
+						mapSet(dst, key, merged)
 					} else {
+						trace.appended(srcKeyPath, dstKeyPath, len(dv), len(sv))
 						mapSet(dst, key, append(dv, sv...))
 					}
 					return
@@ -262,6 +337,12 @@ func hasDuplicatesInList(items []any) bool {
 
 // mergeListItemsIndexed merges source items into destination using an inverted index
 func mergeListItemsIndexed(sourceItems []any, dst *[]any, deduplicate bool) {
+	mergeListItemsTraced(sourceItems, dst, deduplicate, nil, "", "")
+}
+
+// mergeListItemsTraced is mergeListItemsIndexed recording list item positions in
+// trace, where srcPath and dstPath are the paths of the source and destination lists.
+func mergeListItemsTraced(sourceItems []any, dst *[]any, deduplicate bool, trace *mergeTrace, srcPath, dstPath string) {
 	// Build inverted index over destination's dict items
 	destPrimitives := make([]map[string]any, len(*dst))
 	for i, item := range *dst {
@@ -281,15 +362,18 @@ func mergeListItemsIndexed(sourceItems []any, dst *[]any, deduplicate bool) {
 		}
 	}
 
-	for _, srcItem := range sourceItems {
+	for si, srcItem := range sourceItems {
+		srcItemPath := trace.index(srcPath, si)
 		srcMapVal, isMap := asMap(srcItem)
 		if !isMap {
+			trace.record(srcItemPath, trace.index(dstPath, len(*dst)))
 			*dst = append(*dst, srcItem)
 			continue
 		}
 
 		srcPrims := extractPrimitives(srcMapVal)
 		if len(srcPrims) == 0 {
+			trace.record(srcItemPath, trace.index(dstPath, len(*dst)))
 			*dst = append(*dst, srcItem)
 			continue
 		}
@@ -331,7 +415,9 @@ func mergeListItemsIndexed(sourceItems []any, dst *[]any, deduplicate bool) {
 				}
 			}
 			if hasShared && allMatch {
-				MergeMaps(srcMapVal, (*dst)[ci], deduplicate)
+				dstItemPath := trace.index(dstPath, ci)
+				trace.record(srcItemPath, dstItemPath)
+				mergeMapsTraced(srcMapVal, (*dst)[ci], deduplicate, trace, srcItemPath, dstItemPath)
 				// Update primitives cache after merge
 				destPrimitives[ci] = extractPrimitives((*dst)[ci])
 				matched = true
@@ -342,6 +428,7 @@ func mergeListItemsIndexed(sourceItems []any, dst *[]any, deduplicate bool) {
 		if !matched {
 			// Append and update index so later source items can match
 			newIdx := len(*dst)
+			trace.record(srcItemPath, trace.index(dstPath, newIdx))
 			*dst = append(*dst, srcItem)
 			destPrimitives = append(destPrimitives, srcPrims)
 			for k, v := range srcPrims {
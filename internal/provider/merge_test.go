@@ -544,3 +544,35 @@ func TestMergeListItem(t *testing.T) {
 		}
 	}
 }
+
+func TestMergeTrace(t *testing.T) {
+	dst := map[string]any{
+		"ethernets": []any{
+			map[string]any{"id": "1/1", "mtu": 1500},
+			map[string]any{"id": "1/2", "vlans": []any{10}},
+		},
+		"vrfs": []any{"a", "a"},
+	}
+	src := map[string]any{
+		"ethernets": []any{
+			map[string]any{"id": "1/2", "mtu": 9216, "vlans": []any{20}},
+			map[string]any{"id": "1/3"},
+		},
+		"vrfs": []any{"b"},
+	}
+	trace := newMergeTrace()
+	mergeMapsTraced(src, dst, true, trace, "", "")
+
+	expected := map[string]string{
+		"ethernets[0].mtu":      "ethernets[1].mtu",
+		"ethernets[0].vlans[0]": "ethernets[1].vlans[1]",
+		"ethernets[1].id":       "ethernets[2].id",
+		"vrfs[0]":               "vrfs[2]",
+		"other[0]":              "other[0]",
+	}
+	for path, want := range expected {
+		if got := trace.destination(path); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
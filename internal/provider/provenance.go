@@ -0,0 +1,279 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Provenance levels reported by render_device_configs
+const (
+	ProvenanceLevelGlobal         = "global"
+	ProvenanceLevelGroup          = "group"
+	ProvenanceLevelDevice         = "device"
+	ProvenanceLevelDefaults       = "defaults"
+	ProvenanceLevelInterfaceGroup = "interface_group"
+)
+
+// provenanceEntry records where the value of a configuration leaf came from.
+type provenanceEntry struct {
+	Level   string
+	Source  string
+	Default bool
+}
+
+// configLayer is a configuration contributed by one source of the precedence
+// cascade, e.g. a file template, a group configuration or the combined model
+// templates of one level.
+type configLayer struct {
+	source string
+	config map[string]any
+	// sources records the template that set each path of a combined layer. It is
+	// nil if provenance is not tracked.
+	sources *provenanceTracker
+}
+
+// provenanceTracker follows a device configuration through the precedence
+// cascade and records the source of every leaf path, e.g. "system.mtu" or
+// "interfaces.ethernets[0].description". A leaf is attributed to the last step
+// that added it, changed it or set it again. A nil *provenanceTracker only
+// merges and records nothing.
+type provenanceTracker struct {
+	entries map[string]provenanceEntry
+	// leaves holds the leaf values of the configuration after the last step.
+	leaves map[string]any
+	// last is the entry of the last merged layer, used for paths that cannot be
+	// matched to a source.
+	last provenanceEntry
+}
+
+// newProvenanceTracker returns a tracker if the render context tracks provenance.
+func (rctx *renderContext) newProvenanceTracker() *provenanceTracker {
+	if rctx.provenance == nil {
+		return nil
+	}
+	return &provenanceTracker{
+		entries: map[string]provenanceEntry{},
+		leaves:  map[string]any{},
+	}
+}
+
+// merge merges layer into dst and attributes the resulting changes to the layer.
+// List items of the layer are attributed at the index they were merged into,
+// which can differ from their index in the layer.
+func (p *provenanceTracker) merge(dst map[string]any, layer configLayer, level string) {
+	if p == nil || len(layer.config) == 0 {
+		MergeMaps(layer.config, dst, true)
+		return
+	}
+	layerLeaves := configLeaves(layer.config)
+	trace := newMergeTrace()
+	mergeMapsTraced(layer.config, dst, true, trace, "", "")
+
+	// Map the layer leaves to their paths in dst
+	mergedLeaves := make(map[string]any, len(layerLeaves))
+	layerPaths := make(map[string]string, len(layerLeaves))
+	for path, v := range layerLeaves {
+		merged := trace.destination(path)
+		mergedLeaves[merged] = v
+		layerPaths[merged] = path
+	}
+
+	entry := provenanceEntry{Level: level, Source: layer.source}
+	if layer.sources != nil {
+		entry = layer.sources.last
+	}
+	p.last = entry
+	p.diff(dst, mergedLeaves, func(path string) provenanceEntry {
+		if layer.sources != nil {
+			if layerPath, ok := layerPaths[path]; ok {
+				path = layerPath
+			}
+			return layer.sources.lookup(path)
+		}
+		return entry
+	}, true)
+}
+
+// update attributes the paths added or changed in config since the last step,
+// e.g. by applyDefaults, to entryFor.
+func (p *provenanceTracker) update(config map[string]any, entryFor func(path string) provenanceEntry) {
+	if p == nil {
+		return
+	}
+	p.diff(config, nil, entryFor, true)
+}
+
+// refresh picks up values rendered in place, e.g. by the final template pass.
+// Rendered values keep their source and paths below them inherit it.
+func (p *provenanceTracker) refresh(config map[string]any) {
+	if p == nil {
+		return
+	}
+	p.diff(config, nil, p.lookup, false)
+}
+
+// diff compares config with the previous leaves and assigns entryFor to new
+// paths, to changed paths if reassignChanged is set and to paths set again by
+// layerLeaves. Paths that no longer exist are dropped.
+func (p *provenanceTracker) diff(config map[string]any, layerLeaves map[string]any, entryFor func(path string) provenanceEntry, reassignChanged bool) {
+	leaves := configLeaves(config)
+	for path, v := range leaves {
+		prev, existed := p.leaves[path]
+		layerValue, inLayer := layerLeaves[path]
+		switch {
+		case !existed,
+			reassignChanged && !reflect.DeepEqual(prev, v),
+			inLayer && reflect.DeepEqual(layerValue, v):
+			p.entries[path] = entryFor(path)
+		}
+	}
+	for path := range p.entries {
+		if _, ok := leaves[path]; !ok {
+			delete(p.entries, path)
+		}
+	}
+	p.leaves = leaves
+}
+
+// lookup returns the entry of path or of its closest recorded parent path.
+func (p *provenanceTracker) lookup(path string) provenanceEntry {
+	for {
+		if e, ok := p.entries[path]; ok {
+			return e
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i <= 0 {
+			return p.last
+		}
+		path = path[:i]
+	}
+}
+
+// result returns the recorded entries as native values keyed by path.
+func (p *provenanceTracker) result() map[string]any {
+	result := make(map[string]any, len(p.entries))
+	for path, e := range p.entries {
+		result[path] = map[string]any{
+			"level":   e.Level,
+			"source":  e.Source,
+			"default": e.Default,
+		}
+	}
+	return result
+}
+
+// interfaceGroupProvenance returns the entry function for leaves added by
+// applyInterfaceGroups: the last applied interface group of the enclosing
+// interface, among the groups it references, whose configuration sets the path.
+func interfaceGroupProvenance(config map[string]any, igConfigs map[string]map[string]any, priorities map[string]int) func(path string) provenanceEntry {
+	groupLeaves := make(map[string]map[string]any, len(igConfigs))
+	return func(path string) provenanceEntry {
+		groups, rel := enclosingInterfaceGroups(config, path)
+		groups = orderInterfaceGroups(groups, priorities)
+		source := ""
+		for i := len(groups) - 1; i >= 0; i-- {
+			leaves, ok := groupLeaves[groups[i]]
+			if !ok {
+				leaves = configLeaves(igConfigs[groups[i]])
+				groupLeaves[groups[i]] = leaves
+			}
+			if _, ok := leaves[rel]; ok {
+				source = groups[i]
+				break
+			}
+		}
+		if source == "" && len(groups) > 0 {
+			source = groups[len(groups)-1]
+		}
+		return provenanceEntry{Level: ProvenanceLevelInterfaceGroup, Source: source}
+	}
+}
+
+// enclosingInterfaceGroups returns the interface_groups of the innermost map on
+// path that references interface groups, and path relative to that map.
+func enclosingInterfaceGroups(config map[string]any, path string) ([]string, string) {
+	segments, err := parseRefPath(path)
+	if err != nil {
+		return nil, path
+	}
+	var groups []string
+	rel := path
+	var current any = config
+	walked := ""
+	for _, seg := range segments {
+		if m := toMapStringAny(current); m != nil {
+			if g := getStringSlice(m, "interface_groups"); len(g) > 0 {
+				groups = g
+				rel = strings.TrimPrefix(strings.TrimPrefix(path, walked), ".")
+			}
+		}
+		switch seg.kind {
+		case refSegmentKey:
+			m := toMapStringAny(current)
+			if m == nil {
+				return groups, rel
+			}
+			current = m[seg.key]
+			walked = appendKeyPath(walked, seg.key)
+		case refSegmentIndex:
+			list, ok := current.([]any)
+			if !ok || seg.index >= len(list) {
+				return groups, rel
+			}
+			current = list[seg.index]
+			walked = appendIndexPath(walked, seg.index)
+		default:
+			return groups, rel
+		}
+	}
+	return groups, rel
+}
+
+// configLeaves flattens a configuration into its leaf values keyed by path.
+// Empty maps and lists are leaves as well.
+func configLeaves(v any) map[string]any {
+	leaves := map[string]any{}
+	collectConfigLeaves(v, "", leaves)
+	return leaves
+}
+
+func collectConfigLeaves(v any, path string, leaves map[string]any) {
+	if m := toMapStringAny(v); m != nil {
+		if len(m) == 0 && path != "" {
+			leaves[path] = map[string]any{}
+		}
+		for k, item := range m {
+			collectConfigLeaves(item, appendKeyPath(path, k), leaves)
+		}
+		return
+	}
+	if list, ok := v.([]any); ok {
+		if len(list) == 0 && path != "" {
+			leaves[path] = []any{}
+		}
+		for i, item := range list {
+			collectConfigLeaves(item, appendIndexPath(path, i), leaves)
+		}
+		return
+	}
+	if v != nil && path != "" {
+		leaves[path] = v
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderDeviceConfigs_Provenance(t *testing.T) {
+	model := map[string]any{
+		"nxos": map[string]any{
+			"templates": []any{
+				map[string]any{"name": "base", "type": "model", "configuration": map[string]any{
+					"system": map[string]any{"mtu": "${mtu}", "domain": "global.local", "vrfs": "${vrfs}"},
+				}},
+				map[string]any{"name": "spine", "type": "model", "configuration": map[string]any{
+					"system": map[string]any{"domain": "spine.local"},
+				}},
+			},
+			"global": map[string]any{
+				"templates":     []any{"base"},
+				"variables":     map[string]any{"mtu": 9216, "vrfs": []any{"prod", "dev"}},
+				"configuration": map[string]any{"system": map[string]any{"contact": "noc"}},
+			},
+			"device_groups": []any{
+				map[string]any{
+					"name":          "spines",
+					"devices":       []any{"spine1"},
+					"templates":     []any{"spine"},
+					"configuration": map[string]any{"system": map[string]any{"location": "dc1"}},
+				},
+			},
+			"interface_groups": []any{
+				map[string]any{"name": "base_intf", "configuration": map[string]any{"mtu": 1500, "shutdown": false}},
+				map[string]any{"name": "uplinks", "configuration": map[string]any{"mtu": 9000, "description": "uplink"}},
+			},
+			"devices": []any{
+				map[string]any{
+					"name": "spine1",
+					"configuration": map[string]any{
+						"system": map[string]any{"hostname": "spine1", "contact": "noc", "banner": "${vrfs}"},
+						"interfaces": map[string]any{
+							"ethernets": []any{
+								map[string]any{"id": "1/1", "interface_groups": []any{"base_intf", "uplinks"}, "description": "to leaf1"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	defaults := map[string]any{
+		"nxos": map[string]any{
+			"devices": map[string]any{
+				"configuration": map[string]any{"system": map[string]any{"timezone": "UTC", "hostname": "unknown"}},
+			},
+		},
+	}
+
+	_, provenance, err := renderDeviceConfigs(model, nil, nil, nil, defaults, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := provenance["nxos"].(map[string]any)["spine1"].(map[string]any)
+
+	expected := map[string]map[string]any{
+		"system.mtu":                                  {"level": "global", "source": "base", "default": false},
+		"system.vrfs[1]":                              {"level": "global", "source": "base", "default": false},
+		"system.domain":                               {"level": "group", "source": "spine/spines", "default": false},
+		"system.location":                             {"level": "group", "source": "spines", "default": false},
+		"system.contact":                              {"level": "device", "source": "configuration", "default": false},
+		"system.hostname":                             {"level": "device", "source": "configuration", "default": false},
+		"system.banner[1]":                            {"level": "device", "source": "configuration", "default": false},
+		"system.timezone":                             {"level": "defaults", "source": "defaults", "default": true},
+		"interfaces.ethernets[0].description":         {"level": "device", "source": "configuration", "default": false},
+		"interfaces.ethernets[0].mtu":                 {"level": "interface_group", "source": "uplinks", "default": false},
+		"interfaces.ethernets[0].shutdown":            {"level": "interface_group", "source": "base_intf", "default": false},
+		"interfaces.ethernets[0].id":                  {"level": "device", "source": "configuration", "default": false},
+		"interfaces.ethernets[0].interface_groups[0]": {"level": "device", "source": "configuration", "default": false},
+	}
+	for path, want := range expected {
+		if got := entries[path]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+	// Plus system.vrfs[0], system.banner[0] and interface_groups[1]
+	if len(entries) != len(expected)+3 {
+		t.Errorf("expected %d entries, got %d: %v", len(expected)+3, len(entries), entries)
+	}
+}
+
+func TestRenderDeviceConfigs_ProvenanceMergedListItems(t *testing.T) {
+	model := map[string]any{
+		"nxos": map[string]any{
+			"global": map[string]any{
+				"configuration": map[string]any{"ethernets": []any{
+					map[string]any{"id": "1/1", "mtu": 9216},
+					map[string]any{"id": "1/2", "mtu": 9216},
+				}},
+			},
+			"devices": []any{
+				map[string]any{
+					"name": "leaf1",
+					"configuration": map[string]any{"ethernets": []any{
+						map[string]any{"id": "1/2", "mtu": 9216},
+					}},
+				},
+			},
+		},
+	}
+
+	_, provenance, err := renderDeviceConfigs(model, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := provenance["nxos"].(map[string]any)["leaf1"].(map[string]any)
+
+	expected := map[string]string{
+		"ethernets[0].id":  "global",
+		"ethernets[0].mtu": "global",
+		"ethernets[1].id":  "device",
+		"ethernets[1].mtu": "device",
+	}
+	for path, want := range expected {
+		if got := entries[path].(map[string]any)["level"]; got != want {
+			t.Errorf("%s: expected level %s, got %v", path, want, got)
+		}
+	}
+}
+
+func TestRenderDeviceConfigs_ProvenanceDisabled(t *testing.T) {
+	model := map[string]any{
+		"nxos": map[string]any{
+			"devices": []any{map[string]any{"name": "leaf1", "configuration": map[string]any{"a": 1}}},
+		},
+	}
+	_, provenance, err := renderDeviceConfigs(model, nil, nil, nil, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provenance != nil {
+		t.Errorf("expected nil provenance, got %v", provenance)
+	}
+}
+
+func TestConfigLeaves(t *testing.T) {
+	leaves := configLeaves(map[string]any{
+		"a": map[string]any{"b": 1, "c": []any{"x", map[string]any{"d": true}}},
+		"e": map[string]any{},
+		"f": []any{},
+		"g": nil,
+	})
+	expected := map[string]any{
+		"a.b":      1,
+		"a.c[0]":   "x",
+		"a.c[1].d": true,
+		"e":        map[string]any{},
+		"f":        []any{},
+	}
+	if !reflect.DeepEqual(leaves, expected) {
+		t.Errorf("expected %v, got %v", expected, leaves)
+	}
+}
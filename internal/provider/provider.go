@@ -19,13 +19,21 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
 	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
 )
 
+var _ provider.ProviderWithEphemeralResources = (*utilsProvider)(nil)
+
 // provider satisfies the tfsdk.Provider interface and usually is included
 // with all Resource and DataSource implementations.
 type utilsProvider struct {
@@ -40,15 +48,94 @@ type utilsProvider struct {
 	version string
 }
 
+// utilsProviderModel describes the provider configuration.
+type utilsProviderModel struct {
+	EnvAllowlist []string                  `tfsdk:"env_allowlist"`
+	EnvDenylist  []string                  `tfsdk:"env_denylist"`
+	CustomTags   map[string]customTagModel `tfsdk:"custom_tags"`
+}
+
+// customTagModel describes a user-defined YAML tag in the provider configuration.
+type customTagModel struct {
+	Value    types.String `tfsdk:"value"`
+	Env      types.String `tfsdk:"env"`
+	Template types.String `tfsdk:"template"`
+}
+
+// utilsProviderData is passed to data sources and ephemeral resources as provider data.
+type utilsProviderData struct {
+	tagResolver *tagResolver
+}
+
 // Metadata returns the provider type name.
 func (p *utilsProvider) Metadata(_ context.Context, _ provider.MetadataRequest, resp *provider.MetadataResponse) {
 	resp.TypeName = "utils"
 }
 
 func (p *utilsProvider) Schema(ctx context.Context, req provider.SchemaRequest, resp *provider.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Attributes: map[string]schema.Attribute{
+			"env_allowlist": schema.ListAttribute{
+				MarkdownDescription: "A list of patterns (e.g. `NXOS_*`) of environment variables that `!env` tags in data sources are allowed to read. If set, all other variables are blocked. Defaults to the comma-separated list in the `UTILS_ENV_ALLOWLIST` environment variable, which also applies to provider functions.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"env_denylist": schema.ListAttribute{
+				MarkdownDescription: "A list of patterns (e.g. `AWS_*`) of environment variables that `!env` tags in data sources are not allowed to read. Takes precedence over `env_allowlist`. Defaults to the comma-separated list in the `UTILS_ENV_DENYLIST` environment variable, which also applies to provider functions.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"custom_tags": schema.MapNestedAttribute{
+				MarkdownDescription: "User-defined YAML tags resolved by data sources and ephemeral resources, keyed by tag name without the leading `!` (e.g. `site_asn` for `!site_asn`). Each tag expands to exactly one of a literal `value`, an environment variable `env` or an HCL `template`.",
+				Optional:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"value": schema.StringAttribute{
+							MarkdownDescription: "A literal value, decoded as a YAML scalar (e.g. `65000` is a number).",
+							Optional:            true,
+						},
+						"env": schema.StringAttribute{
+							MarkdownDescription: "The name of an environment variable, subject to `env_allowlist` and `env_denylist`.",
+							Optional:            true,
+						},
+						"template": schema.StringAttribute{
+							MarkdownDescription: "An HCL template, where `argument` is the tag argument, e.g. `10.0.0.$${argument}` for `!loopback 1`.",
+							Optional:            true,
+						},
+					},
+				},
+			},
+		},
+	}
 }
 
 func (p *utilsProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
+	var config utilsProviderModel
+
+	diags := req.Config.Get(ctx, &config)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	env, err := providerEnvPolicy(config.EnvAllowlist, config.EnvDenylist)
+	if err != nil {
+		resp.Diagnostics.AddError("Invalid environment variable policy", err.Error())
+		return
+	}
+
+	custom, err := newCustomTags(config.CustomTags)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("custom_tags"), "Invalid custom tag", err.Error())
+		return
+	}
+
+	data := &utilsProviderData{
+		tagResolver: &tagResolver{env: env, custom: custom},
+	}
+	resp.DataSourceData = data
+	resp.EphemeralResourceData = data
+
 	p.configured = true
 }
 
@@ -56,6 +143,12 @@ func (p *utilsProvider) Resources(ctx context.Context) []func() resource.Resourc
 	return nil
 }
 
+func (p *utilsProvider) EphemeralResources(ctx context.Context) []func() ephemeral.EphemeralResource {
+	return []func() ephemeral.EphemeralResource{
+		NewYamlMergeEphemeralResource,
+	}
+}
+
 func (p *utilsProvider) DataSources(ctx context.Context) []func() datasource.DataSource {
 	return []func() datasource.DataSource{
 		NewYamlMergeDataSource,
@@ -75,10 +168,52 @@ func (p *utilsProvider) Functions(ctx context.Context) []func() function.Functio
 		NewYamlDecodeFunction,
 		NewResolveYamlTagsFunction,
 		NewRenderDeviceConfigsFunction,
+		NewYamlTagsFunction,
+		NewTemplateVariablesFunction,
+		NewRenderTemplateFunction,
     NewVersionCompareFunction,
 	}
 }
 
+// newCustomTags validates the custom_tags provider attribute and converts it to
+// the form used by tagResolver.
+func newCustomTags(config map[string]customTagModel) (map[string]customTag, error) {
+	custom := make(map[string]customTag, len(config))
+	for name, m := range config {
+		tag := "!" + strings.TrimPrefix(name, "!")
+		if !customTagNameRegexp.MatchString(tag[1:]) {
+			return nil, fmt.Errorf("invalid tag name %q: must start with a letter and contain only letters, digits, '_' and '-'", name)
+		}
+		if isBuiltinTag(tag) {
+			return nil, fmt.Errorf("tag %s is built in and cannot be redefined", tag)
+		}
+
+		var ct customTag
+		set := 0
+		if !m.Value.IsNull() {
+			value := m.Value.ValueString()
+			ct.value = &value
+			set++
+		}
+		if !m.Env.IsNull() {
+			ct.env = m.Env.ValueString()
+			if ct.env == "" {
+				return nil, fmt.Errorf("tag %s: env must not be empty", tag)
+			}
+			set++
+		}
+		if !m.Template.IsNull() {
+			ct.template = m.Template.ValueString()
+			set++
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("tag %s must set exactly one of value, env or template", tag)
+		}
+		custom[tag] = ct
+	}
+	return custom, nil
+}
+
 func New(version string) func() provider.Provider {
 	return func() provider.Provider {
 		return &utilsProvider{
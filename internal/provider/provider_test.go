@@ -18,10 +18,14 @@
 package provider
 
 import (
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
 )
 
 // testAccProtoV6ProviderFactories are used to instantiate a provider during
@@ -37,3 +41,88 @@ func testAccPreCheck(t *testing.T) {
 	// about the appropriate environment variables being set are common to see in a pre-check
 	// function.
 }
+
+// TestAccProvider_EnvPolicy verifies that an env list missing from the provider
+// configuration falls back to its environment variable, and that an empty
+// env_allowlist blocks all variables.
+func TestAccProvider_EnvPolicy(t *testing.T) {
+	t.Setenv("PROVIDER_ENV_USER", "admin")
+	t.Setenv("PROVIDER_ENV_SECRET", "secret")
+	t.Setenv(envDenylistVar, "PROVIDER_ENV_SECRET")
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				provider "utils" {
+					env_allowlist = ["PROVIDER_ENV_*"]
+				}
+
+				data "utils_yaml_merge" "test" {
+					input = ["user: !env PROVIDER_ENV_USER\n"]
+				}
+				`,
+				Check: resource.TestCheckResourceAttr("data.utils_yaml_merge.test", "output", "user: admin\n"),
+			},
+			{
+				Config: `
+				provider "utils" {
+					env_allowlist = ["PROVIDER_ENV_*"]
+				}
+
+				data "utils_yaml_merge" "test" {
+					input = ["password: !env PROVIDER_ENV_SECRET\n"]
+				}
+				`,
+				ExpectError: regexp.MustCompile(`PROVIDER_ENV_SECRET is blocked by denylist pattern\s+"PROVIDER_ENV_SECRET"\s+in\s+UTILS_ENV_DENYLIST`),
+			},
+			{
+				Config: `
+				provider "utils" {
+					env_allowlist = []
+					env_denylist  = []
+				}
+
+				data "utils_yaml_merge" "test" {
+					input = ["user: !env PROVIDER_ENV_USER\n"]
+				}
+				`,
+				ExpectError: regexp.MustCompile(`PROVIDER_ENV_USER is blocked: it\s+does not match any allowlist pattern`),
+			},
+		},
+	})
+}
+
+func TestNewCustomTags(t *testing.T) {
+	custom, err := newCustomTags(map[string]customTagModel{
+		"site_asn":  {Value: types.StringValue("65000"), Env: types.StringNull(), Template: types.StringNull()},
+		"!mgmt_vrf": {Value: types.StringNull(), Env: types.StringValue("MGMT_VRF"), Template: types.StringNull()},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if custom["!site_asn"].value == nil || *custom["!site_asn"].value != "65000" {
+		t.Errorf("!site_asn: unexpected tag %+v", custom["!site_asn"])
+	}
+	if custom["!mgmt_vrf"].env != "MGMT_VRF" {
+		t.Errorf("!mgmt_vrf: unexpected tag %+v", custom["!mgmt_vrf"])
+	}
+
+	tests := []struct {
+		name    string
+		tag     customTagModel
+		message string
+	}{
+		{"env", customTagModel{Value: types.StringValue("x"), Env: types.StringNull(), Template: types.StringNull()}, "built in"},
+		{"1tag", customTagModel{Value: types.StringValue("x"), Env: types.StringNull(), Template: types.StringNull()}, "invalid tag name"},
+		{"both", customTagModel{Value: types.StringValue("x"), Env: types.StringValue("X"), Template: types.StringNull()}, "exactly one"},
+		{"none", customTagModel{Value: types.StringNull(), Env: types.StringNull(), Template: types.StringNull()}, "exactly one"},
+	}
+	for _, tt := range tests {
+		_, err := newCustomTags(map[string]customTagModel{tt.name: tt.tag})
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.message, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// refTagPrefix marks a reference to another value in the same model.
+const refTagPrefix = "!ref "
+
+// refSegment is one step of a reference path: a map key, a list index or a
+// list item selector of the form [key=value].
+type refSegment struct {
+	key      string
+	index    int
+	selKey   string
+	selValue string
+	kind     refSegmentKind
+}
+
+type refSegmentKind int
+
+const (
+	refSegmentKey refSegmentKind = iota
+	refSegmentIndex
+	refSegmentSelector
+)
+
+// isRefTag reports whether s is a "!ref path" tag string.
+func isRefTag(s string) bool {
+	return strings.HasPrefix(s, refTagPrefix)
+}
+
+// resolveYamlRefs replaces every "!ref path.to.value" string in root with a copy of
+// the value found at that path in root. It is intended to run after all layers have
+// been merged, so that references always see the final value. Paths are dotted map
+// keys with optional list index ("servers[0]") or list item selector
+// ("devices[name=leaf1]") suffixes. Referenced values may contain further
+// references; cycles are reported as errors.
+func resolveYamlRefs(root any) (any, error) {
+	r := &refResolver{
+		root:      root,
+		resolving: make(map[string]bool),
+	}
+	return r.resolveValue(root, "")
+}
+
+// refResolver holds state while resolving references against a single root.
+type refResolver struct {
+	root      any
+	resolving map[string]bool
+	chain     []string
+}
+
+// resolveValue walks v and resolves every reference below it.
+func (r *refResolver) resolveValue(v any, path string) (any, error) {
+	return mapYamlStrings(v, path, func(s, path string) (any, error) {
+		if !isRefTag(s) {
+			return s, nil
+		}
+		resolved, err := r.resolveRef(strings.TrimSpace(strings.TrimPrefix(s, refTagPrefix)))
+		if err != nil && path != "" {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return resolved, err
+	})
+}
+
+// resolveRef looks up a reference path and resolves any references in the target.
+func (r *refResolver) resolveRef(ref string) (any, error) {
+	if r.resolving[ref] {
+		return nil, fmt.Errorf("reference cycle detected: %s -> %s", strings.Join(r.chain, " -> "), ref)
+	}
+
+	segments, err := parseRefPath(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid !ref path %q: %w", ref, err)
+	}
+	target, err := lookupRefPath(r.root, segments)
+	if err != nil {
+		return nil, fmt.Errorf("resolving !ref %s: %w", ref, err)
+	}
+
+	r.resolving[ref] = true
+	r.chain = append(r.chain, ref)
+	defer func() {
+		delete(r.resolving, ref)
+		r.chain = r.chain[:len(r.chain)-1]
+	}()
+
+	return r.resolveValue(deepCopy(target), "")
+}
+
+// parseRefPath splits a reference path such as "devices[name=leaf1].loopbacks[0].ip"
+// into its segments.
+func parseRefPath(path string) ([]refSegment, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var segments []refSegment
+	i := 0
+	expectKey := true
+	for i < len(path) {
+		switch path[i] {
+		case '.':
+			if expectKey {
+				return nil, fmt.Errorf("empty key at offset %d", i)
+			}
+			expectKey = true
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated '[' at offset %d", i)
+			}
+			inner := path[i+1 : i+end]
+			seg, err := parseRefSelector(inner)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, seg)
+			expectKey = false
+			i += end + 1
+		default:
+			if !expectKey {
+				return nil, fmt.Errorf("expected '.' or '[' at offset %d", i)
+			}
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, refSegment{kind: refSegmentKey, key: path[i : i+end]})
+			expectKey = false
+			i += end
+		}
+	}
+	if expectKey {
+		return nil, fmt.Errorf("path ends with '.'")
+	}
+	return segments, nil
+}
+
+// parseRefSelector parses the contents of a bracket segment: either a list index
+// or a key=value item selector.
+func parseRefSelector(inner string) (refSegment, error) {
+	if k, v, ok := strings.Cut(inner, "="); ok {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			return refSegment{}, fmt.Errorf("empty selector key in [%s]", inner)
+		}
+		return refSegment{kind: refSegmentSelector, selKey: k, selValue: strings.TrimSpace(v)}, nil
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(inner))
+	if err != nil || index < 0 {
+		return refSegment{}, fmt.Errorf("invalid list index [%s]", inner)
+	}
+	return refSegment{kind: refSegmentIndex, index: index}, nil
+}
+
+// lookupRefPath follows the segments from root and returns the value found.
+func lookupRefPath(root any, segments []refSegment) (any, error) {
+	current := root
+	walked := ""
+	for _, seg := range segments {
+		switch seg.kind {
+		case refSegmentKey:
+			m := toMapStringAny(current)
+			if m == nil {
+				return nil, fmt.Errorf("%q is not a map", displayRefPath(walked))
+			}
+			v, ok := m[seg.key]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found in %q", seg.key, displayRefPath(walked))
+			}
+			current = v
+			walked = appendKeyPath(walked, seg.key)
+		case refSegmentIndex:
+			list, ok := current.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%q is not a list", displayRefPath(walked))
+			}
+			if seg.index >= len(list) {
+				return nil, fmt.Errorf("index %d out of range for %q (length %d)", seg.index, displayRefPath(walked), len(list))
+			}
+			current = list[seg.index]
+			walked = appendIndexPath(walked, seg.index)
+		case refSegmentSelector:
+			list, ok := current.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%q is not a list", displayRefPath(walked))
+			}
+			found := false
+			for _, item := range list {
+				m := toMapStringAny(item)
+				if m == nil {
+					continue
+				}
+				if v, ok := m[seg.selKey]; ok && v != nil && fmt.Sprint(v) == seg.selValue {
+					current = item
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("no item with %s=%s in %q", seg.selKey, seg.selValue, displayRefPath(walked))
+			}
+			walked = fmt.Sprintf("%s[%s=%s]", walked, seg.selKey, seg.selValue)
+		}
+	}
+	return current, nil
+}
+
+// displayRefPath returns a printable path, using "." for the root.
+func displayRefPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
@@ -0,0 +1,214 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveYamlRefs_AfterMerge(t *testing.T) {
+	base, err := yamlDecode(`
+global:
+  asn: 65000
+  ntp_servers: [10.0.0.1, 10.0.0.2]
+devices:
+  - name: leaf1
+    asn: !ref global.asn
+    ntp: !ref global.ntp_servers
+`)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	override, err := yamlDecode(`
+global:
+  asn: 65100
+`)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	merged := NewOrderedMap(0)
+	MergeMaps(base, merged, true)
+	MergeMaps(override, merged, true)
+
+	resolved, err := resolveYamlRefs(merged)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := yamlEncode(resolved)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	expected := `global:
+  asn: 65100
+  ntp_servers:
+    - 10.0.0.1
+    - 10.0.0.2
+devices:
+  - name: leaf1
+    asn: 65100
+    ntp:
+      - 10.0.0.1
+      - 10.0.0.2
+`
+	if out != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", out, expected)
+	}
+}
+
+func TestResolveYamlRefs_ListSelectorAndIndex(t *testing.T) {
+	input := map[string]any{
+		"devices": []any{
+			map[string]any{"name": "leaf1", "asn": 65001, "loopbacks": []any{"10.1.1.1", "10.1.1.2"}},
+			map[string]any{"name": "leaf2", "asn": 65002},
+		},
+		"peer_asn":      "!ref devices[name=leaf2].asn",
+		"peer_loopback": "!ref devices[name=leaf1].loopbacks[1]",
+		"first_name":    "!ref devices[0].name",
+	}
+
+	result, err := resolveYamlRefs(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := result.(map[string]any)
+	if m["peer_asn"] != 65002 {
+		t.Errorf("peer_asn: expected 65002, got %v", m["peer_asn"])
+	}
+	if m["peer_loopback"] != "10.1.1.2" {
+		t.Errorf("peer_loopback: expected '10.1.1.2', got %v", m["peer_loopback"])
+	}
+	if m["first_name"] != "leaf1" {
+		t.Errorf("first_name: expected 'leaf1', got %v", m["first_name"])
+	}
+}
+
+func TestResolveYamlRefs_Chained(t *testing.T) {
+	input := map[string]any{
+		"a": "!ref b",
+		"b": "!ref c.value",
+		"c": map[string]any{"value": "final"},
+	}
+
+	result, err := resolveYamlRefs(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := result.(map[string]any)
+	if m["a"] != "final" || m["b"] != "final" {
+		t.Errorf("expected chained references to resolve to 'final', got a=%v b=%v", m["a"], m["b"])
+	}
+}
+
+func TestResolveYamlRefs_CopiesTarget(t *testing.T) {
+	input := map[string]any{
+		"src": map[string]any{"x": 1},
+		"dst": "!ref src",
+	}
+
+	result, err := resolveYamlRefs(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := result.(map[string]any)
+	m["dst"].(map[string]any)["x"] = 2
+	if m["src"].(map[string]any)["x"] != 1 {
+		t.Error("expected referenced value to be copied, not shared")
+	}
+}
+
+func TestResolveYamlRefs_Cycle(t *testing.T) {
+	input := map[string]any{
+		"a": "!ref b",
+		"b": map[string]any{"c": "!ref a"},
+	}
+
+	_, err := resolveYamlRefs(input)
+	if err == nil {
+		t.Fatal("expected cycle error")
+	}
+	if !strings.Contains(err.Error(), "reference cycle detected") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestResolveYamlRefs_SelfCycle(t *testing.T) {
+	_, err := resolveYamlRefs(map[string]any{"a": map[string]any{"b": "!ref a"}})
+	if err == nil {
+		t.Fatal("expected cycle error")
+	}
+}
+
+func TestResolveYamlRefs_MissingTargetNamesPath(t *testing.T) {
+	input := map[string]any{
+		"devices": []any{
+			map[string]any{"name": "leaf1", "asn": "!ref global.asn"},
+		},
+	}
+
+	_, err := resolveYamlRefs(input)
+	if err == nil {
+		t.Fatal("expected error for missing target")
+	}
+	if !strings.HasPrefix(err.Error(), "devices[0].asn: ") {
+		t.Errorf("expected error to name the path, got: %v", err)
+	}
+}
+
+func TestParseRefPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []refSegment
+		wantErr  bool
+	}{
+		{path: "a", expected: []refSegment{{kind: refSegmentKey, key: "a"}}},
+		{path: "a.b", expected: []refSegment{{kind: refSegmentKey, key: "a"}, {kind: refSegmentKey, key: "b"}}},
+		{path: "a[2]", expected: []refSegment{{kind: refSegmentKey, key: "a"}, {kind: refSegmentIndex, index: 2}}},
+		{path: "devices[name=leaf1.dc1].asn", expected: []refSegment{
+			{kind: refSegmentKey, key: "devices"},
+			{kind: refSegmentSelector, selKey: "name", selValue: "leaf1.dc1"},
+			{kind: refSegmentKey, key: "asn"},
+		}},
+		{path: "", wantErr: true},
+		{path: "a.", wantErr: true},
+		{path: "a..b", wantErr: true},
+		{path: "a[1", wantErr: true},
+		{path: "a[x]", wantErr: true},
+		{path: "a[0]b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseRefPath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
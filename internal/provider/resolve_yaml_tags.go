@@ -18,46 +18,265 @@
 package provider
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Tag modes control how YAML tag strings are handled
+const (
+	TagModeResolve  = "resolve"  // Resolve tags to their values (default)
+	TagModePreserve = "preserve" // Keep the literal "!tag value"
+	TagModeStrip    = "strip"    // Replace tagged values with null
+	TagModeFail     = "fail"     // Return an error if any tag is present
 )
 
+// ValidTagModes defines valid tag_mode values
+var ValidTagModes = map[string]bool{
+	TagModeResolve:  true,
+	TagModePreserve: true,
+	TagModeStrip:    true,
+	TagModeFail:     true,
+}
+
+// tagStringRegexp matches a string produced by yamlDecode for a custom tag, e.g. "!env HOME".
+var tagStringRegexp = regexp.MustCompile(`(?s)^(![A-Za-z][A-Za-z0-9_-]*) (.*)$`)
+
 // resolveYamlTags recursively walks a native Go value and resolves YAML tag strings.
 // Currently supports the "!env VARNAME" tag, which is resolved to the value of the
-// corresponding environment variable.
+// corresponding environment variable, and the "!age CIPHERTEXT" tag, which is
+// decrypted with the configured age identities. The transform tags "!base64",
+// "!base64decode", "!sha256", "!json" and "!yaml" resolve their argument first
+// and can therefore be stacked on other tags. Errors name the key path of the
+// value that failed to resolve. Access to environment variables is restricted by
+// UTILS_ENV_ALLOWLIST and UTILS_ENV_DENYLIST.
 func resolveYamlTags(v any) (any, error) {
+	r, err := newTagResolverFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return r.resolve(v)
+}
+
+// tagResolver resolves YAML tag strings. The zero value places no restrictions on
+// the environment variables that can be read, knows only the built-in tags and
+// reports unknown tags as errors.
+type tagResolver struct {
+	env    *envPolicy
+	custom map[string]customTag // keyed by tag including "!", e.g. "!site_asn"
+}
+
+// customTag is a user-defined YAML tag declared in the provider configuration. Exactly
+// one of its fields is set.
+type customTag struct {
+	value    *string // literal value, decoded as a YAML scalar
+	env      string  // name of an environment variable
+	template string  // HCL template, rendered with the tag argument as `argument`
+}
+
+// customTagNameRegexp matches valid user-defined tag names (without the leading "!").
+var customTagNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// isBuiltinTag reports whether tag (including "!") is implemented by the provider.
+func isBuiltinTag(tag string) bool {
+	switch tag {
+	case "!env", "!age", "!ref":
+		return true
+	}
+	return isTransformTag(tag)
+}
+
+// newTagResolverFromEnv returns a resolver restricted by the environment variable
+// policy in UTILS_ENV_ALLOWLIST and UTILS_ENV_DENYLIST.
+func newTagResolverFromEnv() (*tagResolver, error) {
+	env, err := envPolicyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &tagResolver{env: env}, nil
+}
+
+// newFunctionTagResolver returns the resolver used by provider functions: restricted
+// by UTILS_ENV_ALLOWLIST and UTILS_ENV_DENYLIST, with the user-defined tags of the
+// custom_tags option, as provider functions cannot read the provider configuration.
+// Tags that are neither built in nor declared in the option are reported as errors.
+func newFunctionTagResolver(opts map[string]any) (*tagResolver, error) {
+	r, err := newTagResolverFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	r.custom, err = optionCustomTags(opts)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// resolve resolves all YAML tags in v, see resolveYamlTags.
+func (r *tagResolver) resolve(v any) (any, error) {
+	return r.resolveAt(v, "")
+}
+
+// parseTagString splits a tag string such as "!env HOME" into its tag and argument.
+func parseTagString(s string) (tag, arg string, ok bool) {
+	m := tagStringRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// applyTagMode handles the YAML tag strings in v according to mode, resolving tags
+// with the environment variable policy from UTILS_ENV_ALLOWLIST and UTILS_ENV_DENYLIST.
+func applyTagMode(v any, mode string) (any, error) {
+	r, err := newTagResolverFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return r.applyTagMode(v, mode)
+}
+
+// applyTagMode handles the YAML tag strings in v according to mode. In "resolve"
+// mode tags are resolved with r.resolve; "preserve" returns v unchanged,
+// "strip" replaces every tagged value with nil and "fail" returns an error naming
+// the first tagged value found. "!ref" tags are left to resolveYamlRefs in
+// "resolve" mode, as they can only be resolved once all layers are merged.
+func (r *tagResolver) applyTagMode(v any, mode string) (any, error) {
+	switch mode {
+	case "", TagModeResolve:
+		return r.resolve(v)
+	case TagModePreserve:
+		return v, nil
+	case TagModeStrip:
+		return mapYamlStrings(v, "", func(s, _ string) (any, error) {
+			if _, _, ok := parseTagString(s); ok {
+				return nil, nil
+			}
+			return s, nil
+		})
+	case TagModeFail:
+		return mapYamlStrings(v, "", func(s, path string) (any, error) {
+			if tag, _, ok := parseTagString(s); ok {
+				return nil, fmt.Errorf("%s: YAML tag %s is not allowed (tag_mode is %q)", displayRefPath(path), tag, mode)
+			}
+			return s, nil
+		})
+	}
+	return nil, fmt.Errorf("invalid tag_mode %q, expected one of: resolve, preserve, strip, fail", mode)
+}
+
+// yamlTagOccurrence is a YAML tag found by findYamlTags.
+type yamlTagOccurrence struct {
+	Tag      string `tfsdk:"tag"`
+	Argument string `tfsdk:"argument"`
+	Path     string `tfsdk:"path"`
+}
+
+// findYamlTags returns every YAML tag string in v without resolving it, sorted by
+// key path. Tags in the argument of a transform tag, e.g. the "!env BANNER" in
+// `!base64 "!env BANNER"`, are reported as separate occurrences at the same path.
+// Tags inside a document embedded with "!yaml" are reported at their path below
+// the tagged value, as they are resolved as if they appeared inline.
+func findYamlTags(v any) []yamlTagOccurrence {
+	occurrences := collectYamlTags(v, "", []yamlTagOccurrence{})
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Path < occurrences[j].Path
+	})
+	return occurrences
+}
+
+// collectYamlTags appends the YAML tag strings in v to occurrences, where path
+// is the key path of v.
+func collectYamlTags(v any, path string, occurrences []yamlTagOccurrence) []yamlTagOccurrence {
+	_, _ = mapYamlStrings(v, path, func(s, path string) (any, error) {
+		for {
+			tag, arg, ok := parseTagString(s)
+			if !ok {
+				break
+			}
+			occurrences = append(occurrences, yamlTagOccurrence{Tag: tag, Argument: arg, Path: displayRefPath(path)})
+			if tag == "!yaml" {
+				if _, _, ok := parseTagString(arg); !ok {
+					if decoded, err := yamlDecode(arg); err == nil {
+						occurrences = collectYamlTags(decoded, path, occurrences)
+					}
+					break
+				}
+			}
+			if !isTransformTag(tag) {
+				break
+			}
+			s = arg
+		}
+		return s, nil
+	})
+	return occurrences
+}
+
+// taggedPaths returns the unique key paths of the YAML tag strings in v, sorted.
+func taggedPaths(v any) []string {
+	paths := []string{}
+	for _, o := range findYamlTags(v) {
+		if len(paths) == 0 || paths[len(paths)-1] != o.Path {
+			paths = append(paths, o.Path)
+		}
+	}
+	return paths
+}
+
+// resolveAt resolves YAML tags below the given key path.
+func (r *tagResolver) resolveAt(v any, path string) (any, error) {
+	return mapYamlStrings(v, path, func(s, path string) (any, error) {
+		resolved, err := r.resolveTagString(s)
+		if err != nil && path != "" {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return resolved, err
+	})
+}
+
+// mapYamlStrings recursively copies a native Go value, replacing every string with
+// the result of fn. fn receives the key path of the string, e.g. "devices[0].name".
+func mapYamlStrings(v any, path string, fn func(s, path string) (any, error)) (any, error) {
 	switch val := v.(type) {
 	case string:
-		return resolveTagString(val)
+		return fn(val, path)
 	case *OrderedMap:
 		result := NewOrderedMap(val.Len())
 		for _, e := range val.Entries() {
-			resolved, err := resolveYamlTags(e.Value)
+			mapped, err := mapYamlStrings(e.Value, appendKeyPath(path, e.Key), fn)
 			if err != nil {
 				return nil, err
 			}
-			result.Set(e.Key, resolved)
+			result.Set(e.Key, mapped)
 		}
 		return result, nil
 	case map[string]any:
 		result := make(map[string]any, len(val))
 		for k, v := range val {
-			resolved, err := resolveYamlTags(v)
+			mapped, err := mapYamlStrings(v, appendKeyPath(path, k), fn)
 			if err != nil {
 				return nil, err
 			}
-			result[k] = resolved
+			result[k] = mapped
 		}
 		return result, nil
 	case []any:
 		result := make([]any, len(val))
 		for i, v := range val {
-			resolved, err := resolveYamlTags(v)
+			mapped, err := mapYamlStrings(v, appendIndexPath(path, i), fn)
 			if err != nil {
 				return nil, err
 			}
-			result[i] = resolved
+			result[i] = mapped
 		}
 		return result, nil
 	default:
@@ -67,15 +286,127 @@ func resolveYamlTags(v any) (any, error) {
 }
 
 // resolveTagString checks if a string contains a known YAML tag prefix and resolves it.
-func resolveTagString(s string) (any, error) {
+func (r *tagResolver) resolveTagString(s string) (any, error) {
 	if strings.HasPrefix(s, "!env ") {
 		varName := strings.TrimPrefix(s, "!env ")
 		varName = strings.TrimSpace(varName)
+		if err := r.env.check(varName); err != nil {
+			return nil, err
+		}
 		value := os.Getenv(varName)
 		if value == "" {
 			return nil, fmt.Errorf("environment variable %s not set", varName)
 		}
 		return value, nil
 	}
+	if strings.HasPrefix(s, "!age ") {
+		return resolveAgeTag(strings.TrimPrefix(s, "!age "))
+	}
+	if tag, arg, ok := strings.Cut(s, " "); ok && isTransformTag(tag) {
+		return r.resolveTransformTag(tag, arg)
+	}
+	if tag, arg, ok := parseTagString(s); ok {
+		if isRefTag(s) {
+			// Resolved by resolveYamlRefs once all layers are merged
+			return s, nil
+		}
+		if ct, ok := r.custom[tag]; ok {
+			return r.resolveCustomTag(tag, ct, arg)
+		}
+		return nil, fmt.Errorf("unknown YAML tag %s", tag)
+	}
 	return s, nil
 }
+
+// resolveCustomTag resolves a user-defined tag to its literal value, environment
+// variable or rendered template.
+func (r *tagResolver) resolveCustomTag(tag string, ct customTag, arg string) (any, error) {
+	switch {
+	case ct.value != nil:
+		value, err := yamlDecode(*ct.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: decoding value: %w", tag, err)
+		}
+		return value, nil
+	case ct.env != "":
+		return r.resolveTagString("!env " + ct.env)
+	default:
+		value, err := renderHCLTemplateValue(ct.template, map[string]cty.Value{
+			"argument": cty.StringVal(arg),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", tag, err)
+		}
+		return value, nil
+	}
+}
+
+// isTransformTag reports whether tag transforms the value of its argument.
+func isTransformTag(tag string) bool {
+	switch tag {
+	case "!base64", "!base64decode", "!sha256", "!json", "!yaml":
+		return true
+	}
+	return false
+}
+
+// resolveTransformTag resolves the argument of a transform tag, which may itself
+// be a tagged string (e.g. `!base64 "!env BANNER"`), and applies the transform.
+func (r *tagResolver) resolveTransformTag(tag, arg string) (any, error) {
+	if isRefTag(arg) {
+		return nil, fmt.Errorf("%s cannot be applied to a !ref tag", tag)
+	}
+	inner, err := r.resolveTagString(arg)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := inner.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a string argument, got %T", tag, inner)
+	}
+
+	switch tag {
+	case "!base64":
+		return base64.StdEncoding.EncodeToString([]byte(value)), nil
+	case "!base64decode":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to decode base64: %w", tag, err)
+		}
+		return string(decoded), nil
+	case "!sha256":
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:]), nil
+	case "!json":
+		if !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("%s: invalid JSON", tag)
+		}
+		// JSON is a subset of YAML, decoding it this way keeps key order and number types consistent
+		decoded, err := yamlDecode(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", tag, err)
+		}
+		return decoded, nil
+	case "!yaml":
+		decoded, err := yamlDecode(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", tag, err)
+		}
+		// Tags inside the embedded document are resolved as if they appeared inline
+		return r.resolve(decoded)
+	}
+	return nil, fmt.Errorf("unsupported transform tag %s", tag)
+}
+
+// appendKeyPath appends a map key to a dotted key path, e.g. "devices[0]" + "name".
+func appendKeyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// appendIndexPath appends a list index to a key path, e.g. "devices" + 0.
+func appendIndexPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
@@ -0,0 +1,174 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+// compileConfigSchemas compiles the JSON Schemas of the schemas option, a map of
+// architecture to a schema given as an object or a JSON string. Schemas default to
+// draft 2020-12 and cannot reference external documents.
+func compileConfigSchemas(v any) (map[string]*jsonschema.Schema, error) {
+	if v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("option %s must be a map of architecture to JSON Schema, got %T", OptionSchemas, v)
+	}
+
+	schemas := make(map[string]*jsonschema.Schema, len(m))
+	for arch, raw := range m {
+		doc := raw
+		if s, ok := raw.(string); ok {
+			decoded, err := jsonschema.UnmarshalJSON(strings.NewReader(s))
+			if err != nil {
+				return nil, fmt.Errorf("schema for %q: decoding JSON: %w", arch, err)
+			}
+			doc = decoded
+		}
+
+		c := jsonschema.NewCompiler()
+		c.UseLoader(jsonschema.SchemeURLLoader{})
+		url := "urn:render-device-configs:schema:" + arch
+		if err := c.AddResource(url, doc); err != nil {
+			return nil, fmt.Errorf("schema for %q: %w", arch, err)
+		}
+		schema, err := c.Compile(url)
+		if err != nil {
+			return nil, fmt.Errorf("schema for %q: %w", arch, err)
+		}
+		schemas[arch] = schema
+	}
+	return schemas, nil
+}
+
+// validateDeviceConfigs validates the configuration of every rendered device
+// against the schema of its architecture. All failures of all devices are
+// reported together, one per line, with the device and the path of the value.
+// A schema for an architecture that is not in the result is reported as an error.
+func validateDeviceConfigs(result any, schemas map[string]*jsonschema.Schema) error {
+	archs, ok := result.(map[string]any)
+	if !ok || len(schemas) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(archs))
+	for arch := range archs {
+		names = append(names, arch)
+	}
+	sort.Strings(names)
+
+	unknown := make([]string, 0)
+	for arch := range schemas {
+		if _, ok := archs[arch]; !ok {
+			unknown = append(unknown, arch)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("schema for %q: architecture not found in model, expected one of: %s", unknown[0], strings.Join(names, ", "))
+	}
+
+	var failures []string
+	for _, arch := range names {
+		schema, ok := schemas[arch]
+		if !ok {
+			continue
+		}
+		for _, deviceRaw := range getSliceVal(toMapStringAny(archs[arch]), "devices") {
+			device := toMapStringAny(deviceRaw)
+			config, ok := device["configuration"]
+			if !ok {
+				config = map[string]any{}
+			}
+			err := schema.Validate(config)
+			if err == nil {
+				continue
+			}
+			var verr *jsonschema.ValidationError
+			if !errors.As(err, &verr) {
+				return fmt.Errorf("%s device %q: %w", arch, getStringVal(device, "name", ""), err)
+			}
+			for _, f := range schemaFailures(verr, config) {
+				failures = append(failures, fmt.Sprintf("%s device %q: %s", arch, getStringVal(device, "name", ""), f))
+			}
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d schema validation error(s):\n%s", len(failures), strings.Join(failures, "\n"))
+}
+
+// schemaFailures flattens a validation error into sorted "path: reason" messages,
+// one per failed keyword, with paths in the dotted form used elsewhere (e.g.
+// "interfaces.ethernets[0].mtu", "." for the configuration itself). Grouping
+// errors that only wrap other failures are left out.
+func schemaFailures(verr *jsonschema.ValidationError, instance any) []string {
+	var failures []string
+	seen := make(map[string]bool)
+	for _, unit := range verr.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		if _, ok := unit.Error.Kind.(*kind.Group); ok {
+			continue
+		}
+		f := fmt.Sprintf("%s: %s", displayRefPath(instancePath(instance, unit.InstanceLocation)), unit.Error.String())
+		if !seen[f] {
+			seen[f] = true
+			failures = append(failures, f)
+		}
+	}
+	if len(failures) == 0 {
+		failures = append(failures, verr.Error())
+	}
+	sort.Strings(failures)
+	return failures
+}
+
+// instancePath converts a JSON pointer into a dotted key path, using the
+// instance to tell list indices from map keys.
+func instancePath(instance any, pointer string) string {
+	if pointer == "" {
+		return ""
+	}
+	path := ""
+	current := instance
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		if list, ok := current.([]any); ok {
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(list) {
+				path = appendIndexPath(path, i)
+				current = list[i]
+				continue
+			}
+		}
+		path = appendKeyPath(path, token)
+		current = toMapStringAny(current)[token]
+	}
+	return path
+}
@@ -0,0 +1,171 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+const testInterfacesSchema = `{
+  "type": "object",
+  "properties": {
+    "system": {
+      "type": "object",
+      "properties": {
+        "mtu": {"type": "integer", "minimum": 576, "maximum": 9216}
+      }
+    },
+    "interfaces": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "ethernets": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["name"],
+            "properties": {
+              "name": {"type": "string"},
+              "mtu": {"type": "integer", "maximum": 9216}
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func TestValidateDeviceConfigs(t *testing.T) {
+	schemas, err := compileConfigSchemas(map[string]any{"nxos": testInterfacesSchema})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := map[string]any{
+		"nxos": map[string]any{
+			"devices": []any{
+				map[string]any{
+					"name": "leaf1",
+					"configuration": map[string]any{
+						"system": map[string]any{"mtu": 9216},
+						"interfaces": map[string]any{
+							"ethernets": []any{map[string]any{"name": "Ethernet1/1", "mtu": 1500}},
+						},
+					},
+				},
+				map[string]any{
+					"name": "leaf2",
+					"configuration": map[string]any{
+						"system": map[string]any{"mtu": "jumbo"},
+						"interfaces": map[string]any{
+							"ethernet": []any{},
+							"ethernets": []any{
+								map[string]any{"name": "Ethernet1/1"},
+								map[string]any{"mtu": 10000},
+							},
+						},
+					},
+				},
+			},
+		},
+		"iosxe": map[string]any{
+			"devices": []any{
+				map[string]any{"name": "router1", "configuration": map[string]any{"anything": true}},
+			},
+		},
+	}
+
+	err = validateDeviceConfigs(result, schemas)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, expected := range []string{
+		"4 schema validation error(s)",
+		`nxos device "leaf2": system.mtu: `,
+		`nxos device "leaf2": interfaces: additional properties 'ethernet' not allowed`,
+		`nxos device "leaf2": interfaces.ethernets[1]: missing property 'name'`,
+		`nxos device "leaf2": interfaces.ethernets[1].mtu: `,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got:\n%v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "leaf1") || strings.Contains(err.Error(), "router1") {
+		t.Errorf("expected only leaf2 to fail, got:\n%v", err)
+	}
+}
+
+func TestValidateDeviceConfigs_Valid(t *testing.T) {
+	schemas, err := compileConfigSchemas(map[string]any{
+		"nxos": map[string]any{"type": "object", "required": []any{"system"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := map[string]any{
+		"nxos": map[string]any{
+			"devices": []any{
+				map[string]any{"name": "leaf1", "configuration": map[string]any{"system": map[string]any{}}},
+			},
+		},
+	}
+	if err := validateDeviceConfigs(result, schemas); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateDeviceConfigs_UnknownArchitecture(t *testing.T) {
+	schemas, err := compileConfigSchemas(map[string]any{
+		"nxos": map[string]any{"type": "object"},
+		"nxso": map[string]any{"type": "object"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := map[string]any{
+		"iosxe": map[string]any{"devices": []any{}},
+		"nxos":  map[string]any{"devices": []any{}},
+	}
+	err = validateDeviceConfigs(result, schemas)
+	expected := `schema for "nxso": architecture not found in model, expected one of: iosxe, nxos`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestCompileConfigSchemas_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		schemas  any
+		expected string
+	}{
+		{name: "not a map", schemas: "{}", expected: "must be a map of architecture to JSON Schema"},
+		{name: "invalid JSON", schemas: map[string]any{"nxos": "{"}, expected: `schema for "nxos": decoding JSON`},
+		{name: "invalid schema", schemas: map[string]any{"nxos": map[string]any{"type": 1}}, expected: `schema for "nxos"`},
+		{name: "external reference", schemas: map[string]any{"nxos": map[string]any{"$ref": "file:///etc/schema.json"}}, expected: `schema for "nxos"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileConfigSchemas(tt.schemas)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	// sopsMetadataKey is the top-level key holding SOPS metadata in an encrypted document.
+	sopsMetadataKey = "sops"
+
+	// ageArmorHeader is the first line of an ASCII-armored age ciphertext.
+	ageArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+)
+
+// sopsValueRegexp matches a single SOPS-encrypted value, e.g.
+// "ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]".
+var sopsValueRegexp = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.*),tag:(.*),type:(.*)\]$`)
+
+// loadAgeIdentities reads the age identities used to decrypt `!age` values and
+// SOPS documents. Like the sops CLI, identities are collected from the SOPS_AGE_KEY
+// environment variable, the file named by SOPS_AGE_KEY_FILE and the default
+// sops/age/keys.txt file in the user configuration directory.
+func loadAgeIdentities() ([]age.Identity, error) {
+	var identities []age.Identity
+
+	if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+		ids, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("parsing age identities from SOPS_AGE_KEY: %w", err)
+		}
+		identities = append(identities, ids...)
+	}
+
+	keyFile := os.Getenv("SOPS_AGE_KEY_FILE")
+	explicit := keyFile != ""
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			keyFile = filepath.Join(dir, "sops", "age", "keys.txt")
+		}
+	}
+	if keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		switch {
+		case err == nil:
+			ids, err := age.ParseIdentities(bytes.NewReader(content))
+			if err != nil {
+				return nil, fmt.Errorf("parsing age identity file %s: %w", keyFile, err)
+			}
+			identities = append(identities, ids...)
+		case explicit || !os.IsNotExist(err):
+			return nil, fmt.Errorf("reading age identity file: %w", err)
+		}
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no age identity found: set SOPS_AGE_KEY or SOPS_AGE_KEY_FILE")
+	}
+	return identities, nil
+}
+
+// decryptAge decrypts an age ciphertext, given either in ASCII-armored form or
+// as base64-encoded binary, and returns the plaintext.
+func decryptAge(ciphertext string, identities []age.Identity) ([]byte, error) {
+	ciphertext = strings.TrimSpace(ciphertext)
+
+	var src io.Reader
+	if strings.HasPrefix(ciphertext, ageArmorHeader) {
+		src = armor.NewReader(strings.NewReader(ciphertext))
+	} else {
+		raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(ciphertext), ""))
+		if err != nil {
+			return nil, fmt.Errorf("age ciphertext is neither armored nor valid base64: %w", err)
+		}
+		src = bytes.NewReader(raw)
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// resolveAgeTag decrypts the argument of an `!age` tag using the configured identities.
+func resolveAgeTag(ciphertext string) (any, error) {
+	identities, err := loadAgeIdentities()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decryptAge(ciphertext, identities)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting !age value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// isSopsDocument reports whether a decoded YAML document carries SOPS metadata.
+func isSopsDocument(v any) bool {
+	doc, ok := v.(*OrderedMap)
+	if !ok {
+		return false
+	}
+	meta, ok := doc.Get(sopsMetadataKey)
+	if !ok {
+		return false
+	}
+	_, ok = meta.(*OrderedMap)
+	return ok
+}
+
+// sopsEncryptedPaths returns the key paths of the encrypted values of a SOPS
+// document, or nil if v is not a SOPS document.
+func sopsEncryptedPaths(v any) []string {
+	if !isSopsDocument(v) {
+		return nil
+	}
+	var paths []string
+	for _, e := range v.(*OrderedMap).Entries() {
+		if e.Key == sopsMetadataKey {
+			continue
+		}
+		_, _ = mapYamlStrings(e.Value, appendKeyPath("", e.Key), func(s, path string) (any, error) {
+			if sopsValueRegexp.MatchString(s) {
+				paths = append(paths, path)
+			}
+			return s, nil
+		})
+	}
+	return paths
+}
+
+// decryptSopsDocument decrypts a SOPS-encrypted YAML document produced by yamlDecode.
+// Documents without SOPS metadata are returned unchanged. The data key is recovered
+// from the age recipients in the metadata, every "ENC[...]" value is decrypted in
+// place and the metadata key is removed. The document MAC is not verified; each
+// value is still authenticated against its key path by AES-GCM.
+func decryptSopsDocument(v any) (any, error) {
+	if !isSopsDocument(v) {
+		return v, nil
+	}
+	doc := v.(*OrderedMap)
+	meta, _ := doc.Get(sopsMetadataKey)
+
+	dataKey, err := sopsDataKey(meta.(*OrderedMap))
+	if err != nil {
+		return nil, fmt.Errorf("sops: %w", err)
+	}
+
+	result := NewOrderedMap(doc.Len())
+	for _, e := range doc.Entries() {
+		if e.Key == sopsMetadataKey {
+			continue
+		}
+		decrypted, err := decryptSopsTree(e.Value, dataKey, []string{e.Key}, e.Key)
+		if err != nil {
+			return nil, fmt.Errorf("sops: %w", err)
+		}
+		result.Set(e.Key, decrypted)
+	}
+	return result, nil
+}
+
+// sopsDataKey recovers the document data key from the age recipient stanzas.
+func sopsDataKey(meta *OrderedMap) ([]byte, error) {
+	recipients, _ := meta.Get("age")
+	list, ok := recipients.([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("document has no age recipients")
+	}
+
+	identities, err := loadAgeIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, r := range list {
+		m, ok := r.(*OrderedMap)
+		if !ok {
+			continue
+		}
+		enc, ok := m.Get("enc")
+		if !ok {
+			continue
+		}
+		s, ok := enc.(string)
+		if !ok {
+			continue
+		}
+		key, err := decryptAge(s, identities)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return key, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no age recipient stanza found")
+	}
+	return nil, fmt.Errorf("decrypting data key: %w", lastErr)
+}
+
+// decryptSopsTree walks a document subtree and decrypts SOPS values. aad holds
+// the map keys leading to the value (SOPS does not include list indices in the
+// authenticated data), while path is the full key path used in error messages.
+func decryptSopsTree(v any, dataKey []byte, aad []string, path string) (any, error) {
+	switch val := v.(type) {
+	case *OrderedMap:
+		result := NewOrderedMap(val.Len())
+		for _, e := range val.Entries() {
+			decrypted, err := decryptSopsTree(e.Value, dataKey, append(aad[:len(aad):len(aad)], e.Key), appendKeyPath(path, e.Key))
+			if err != nil {
+				return nil, err
+			}
+			result.Set(e.Key, decrypted)
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(val))
+		for i, item := range val {
+			decrypted, err := decryptSopsTree(item, dataKey, aad, appendIndexPath(path, i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = decrypted
+		}
+		return result, nil
+	case string:
+		if !sopsValueRegexp.MatchString(val) {
+			return val, nil
+		}
+		decrypted, err := decryptSopsValue(val, dataKey, strings.Join(aad, ":")+":")
+		if err != nil {
+			return nil, fmt.Errorf("decrypting value at %s: %w", path, err)
+		}
+		return decrypted, nil
+	default:
+		return v, nil
+	}
+}
+
+// decryptSopsValue decrypts a single "ENC[AES256_GCM,...]" value and converts it
+// back to its original type.
+func decryptSopsValue(value string, dataKey []byte, additionalData string) (any, error) {
+	matches := sopsValueRegexp.FindStringSubmatch(value)
+	if matches == nil {
+		return nil, fmt.Errorf("malformed encrypted value")
+	}
+	data, err := base64.StdEncoding.DecodeString(matches[1])
+	if err != nil {
+		return nil, fmt.Errorf("decoding data: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(matches[2])
+	if err != nil {
+		return nil, fmt.Errorf("decoding iv: %w", err)
+	}
+	tag, err := base64.StdEncoding.DecodeString(matches[3])
+	if err != nil {
+		return nil, fmt.Errorf("decoding tag: %w", err)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return nil, err
+	}
+
+	s := string(plaintext)
+	switch valueType := matches[4]; valueType {
+	case "str", "bytes":
+		return s, nil
+	case "int":
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %q to integer: %w", s, err)
+		}
+		return i, nil
+	case "float":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %q to float: %w", s, err)
+		}
+		return f, nil
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %q to bool: %w", s, err)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %q", valueType)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// testAgeIdentity generates an age identity and exposes it through SOPS_AGE_KEY.
+func testAgeIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generating age identity: %v", err)
+	}
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	return identity
+}
+
+// testAgeEncrypt encrypts plaintext to the recipient, armored or base64-encoded.
+func testAgeEncrypt(t *testing.T, recipient age.Recipient, plaintext []byte, armored bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var dst io.Writer = &buf
+	var a io.WriteCloser
+	if armored {
+		a = armor.NewWriter(&buf)
+		dst = a
+	}
+	w, err := age.Encrypt(dst, recipient)
+	if err != nil {
+		t.Fatalf("age encrypt: %v", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("age encrypt: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("age encrypt: %v", err)
+	}
+	if armored {
+		if err := a.Close(); err != nil {
+			t.Fatalf("age armor: %v", err)
+		}
+		return buf.String()
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// testSopsEncryptValue produces a SOPS "ENC[...]" value for plaintext.
+func testSopsEncryptValue(t *testing.T, dataKey []byte, plaintext, valueType, additionalData string) string {
+	t.Helper()
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		t.Fatalf("aes: %v", err)
+	}
+	iv := make([]byte, 32)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatalf("iv: %v", err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		t.Fatalf("gcm: %v", err)
+	}
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), []byte(additionalData))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(data),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(tag),
+		valueType)
+}
+
+// testSopsDocument builds a SOPS-encrypted YAML document for the given identity.
+func testSopsDocument(t *testing.T, identity *age.X25519Identity) string {
+	t.Helper()
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatalf("data key: %v", err)
+	}
+	enc := testAgeEncrypt(t, identity.Recipient(), dataKey, true)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "device:\n")
+	fmt.Fprintf(&sb, "  name: %s\n", testSopsEncryptValue(t, dataKey, "leaf1", "str", "device:name:"))
+	fmt.Fprintf(&sb, "  asn: %s\n", testSopsEncryptValue(t, dataKey, "65001", "int", "device:asn:"))
+	fmt.Fprintf(&sb, "  enabled: %s\n", testSopsEncryptValue(t, dataKey, "true", "bool", "device:enabled:"))
+	fmt.Fprintf(&sb, "  users:\n")
+	fmt.Fprintf(&sb, "    - %s\n", testSopsEncryptValue(t, dataKey, "admin", "str", "device:users:"))
+	fmt.Fprintf(&sb, "  comment_unencrypted: plain\n")
+	fmt.Fprintf(&sb, "sops:\n  age:\n    - recipient: %s\n      enc: |\n", identity.Recipient())
+	for _, line := range strings.Split(strings.TrimSpace(enc), "\n") {
+		fmt.Fprintf(&sb, "        %s\n", line)
+	}
+	fmt.Fprintf(&sb, "  version: 3.9.0\n")
+	return sb.String()
+}
+
+func TestResolveYamlTags_AgeArmored(t *testing.T) {
+	identity := testAgeIdentity(t)
+	ciphertext := testAgeEncrypt(t, identity.Recipient(), []byte("s3cret"), true)
+
+	result, err := resolveYamlTags("!age " + ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "s3cret" {
+		t.Errorf("expected 's3cret', got %v", result)
+	}
+}
+
+func TestResolveYamlTags_AgeBase64(t *testing.T) {
+	identity := testAgeIdentity(t)
+	ciphertext := testAgeEncrypt(t, identity.Recipient(), []byte("s3cret"), false)
+
+	result, err := resolveYamlTags(map[string]any{"password": "!age " + ciphertext})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := result.(map[string]any)["password"]; got != "s3cret" {
+		t.Errorf("expected 's3cret', got %v", got)
+	}
+}
+
+func TestResolveYamlTags_AgeIdentityFile(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generating age identity: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keyFile, []byte("# test key\n"+identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("writing key file: %v", err)
+	}
+	t.Setenv("SOPS_AGE_KEY", "")
+	t.Setenv("SOPS_AGE_KEY_FILE", keyFile)
+
+	ciphertext := testAgeEncrypt(t, identity.Recipient(), []byte("from-file"), true)
+	result, err := resolveYamlTags("!age " + ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "from-file" {
+		t.Errorf("expected 'from-file', got %v", result)
+	}
+}
+
+func TestResolveYamlTags_AgeErrorNamesPath(t *testing.T) {
+	testAgeIdentity(t)
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generating age identity: %v", err)
+	}
+	ciphertext := testAgeEncrypt(t, other.Recipient(), []byte("s3cret"), true)
+
+	input := map[string]any{
+		"devices": []any{
+			map[string]any{"password": "!age " + ciphertext},
+		},
+	}
+	_, err = resolveYamlTags(input)
+	if err == nil {
+		t.Fatal("expected error for ciphertext encrypted to another recipient")
+	}
+	if !strings.HasPrefix(err.Error(), "devices[0].password: ") {
+		t.Errorf("expected error to name the path, got: %v", err)
+	}
+}
+
+func TestResolveYamlTags_AgeNoIdentity(t *testing.T) {
+	t.Setenv("SOPS_AGE_KEY", "")
+	t.Setenv("SOPS_AGE_KEY_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+
+	_, err := resolveYamlTags("!age AAAA")
+	if err == nil {
+		t.Fatal("expected error without age identity")
+	}
+}
+
+func TestDecryptSopsDocument(t *testing.T) {
+	identity := testAgeIdentity(t)
+
+	decoded, err := yamlDecode(testSopsDocument(t, identity))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	decrypted, err := decryptSopsDocument(decoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	doc := decrypted.(*OrderedMap)
+	if doc.Has(sopsMetadataKey) {
+		t.Error("expected sops metadata to be removed")
+	}
+	device, _ := doc.Get("device")
+	dm := device.(*OrderedMap)
+	expected := map[string]any{"name": "leaf1", "asn": 65001, "enabled": true, "comment_unencrypted": "plain"}
+	for k, want := range expected {
+		if got, _ := dm.Get(k); got != want {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", k, want, want, got, got)
+		}
+	}
+	users, _ := dm.Get("users")
+	if u := users.([]any); len(u) != 1 || u[0] != "admin" {
+		t.Errorf("users: expected [admin], got %v", u)
+	}
+}
+
+func TestDecryptSopsDocument_TamperedValueNamesPath(t *testing.T) {
+	identity := testAgeIdentity(t)
+
+	// Move an encrypted value to a different key so its authenticated data no longer matches
+	doc := strings.Replace(testSopsDocument(t, identity), "  name: ENC[", "  hostname: ENC[", 1)
+	decoded, err := yamlDecode(doc)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	_, err = decryptSopsDocument(decoded)
+	if err == nil {
+		t.Fatal("expected error for tampered value")
+	}
+	if !strings.Contains(err.Error(), "device.hostname") {
+		t.Errorf("expected error to name the path, got: %v", err)
+	}
+}
+
+func TestDecryptSopsDocument_PlainDocument(t *testing.T) {
+	decoded, err := yamlDecode("a: ENC[not really]\nsops: plain\n")
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	result, err := decryptSopsDocument(decoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.(*OrderedMap).Len() != 2 {
+		t.Errorf("expected plain document to be returned unchanged, got %v", result)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// templateAnalysis lists the variables and functions referenced by an HCL template.
+type templateAnalysis struct {
+	Variables          []string `tfsdk:"variables"`
+	Functions          []string `tfsdk:"functions"`
+	UndefinedVariables []string `tfsdk:"undefined_variables"`
+	UnknownFunctions   []string `tfsdk:"unknown_functions"`
+}
+
+// analyzeTemplate parses an HCL template and returns the variable traversals and
+// function calls it contains, each sorted and without duplicates. Variables
+// declared by for expressions are not reported. If vars is not nil, references
+// that cannot be resolved against vars and calls of functions that are not
+// available in templates are reported as well.
+func analyzeTemplate(tmpl string, vars map[string]cty.Value) (*templateAnalysis, error) {
+	expr, diags := hclsyntax.ParseTemplate([]byte(tmpl), "template", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parsing template: %s", diags.Error())
+	}
+
+	result := &templateAnalysis{Variables: []string{}, Functions: []string{}}
+
+	traversals := expr.Variables()
+	seenVars := make(map[string]bool, len(traversals))
+	var undefined []string
+	for _, traversal := range traversals {
+		name := formatTraversal(traversal)
+		if seenVars[name] {
+			continue
+		}
+		seenVars[name] = true
+		result.Variables = append(result.Variables, name)
+		if vars != nil {
+			if _, diags := traversal.TraverseAbs(&hcl.EvalContext{Variables: vars}); diags.HasErrors() {
+				undefined = append(undefined, name)
+			}
+		}
+	}
+	sort.Strings(result.Variables)
+
+	seenFuncs := make(map[string]bool)
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok && !seenFuncs[call.Name] {
+			seenFuncs[call.Name] = true
+			result.Functions = append(result.Functions, call.Name)
+		}
+		return nil
+	})
+	sort.Strings(result.Functions)
+
+	if vars != nil {
+		sort.Strings(undefined)
+		result.UndefinedVariables = append([]string{}, undefined...)
+		result.UnknownFunctions = []string{}
+		known := hclTemplateFunctions()
+		for _, name := range result.Functions {
+			if _, ok := known[name]; !ok && name != "include" {
+				result.UnknownFunctions = append(result.UnknownFunctions, name)
+			}
+		}
+	}
+	return result, nil
+}
+
+// formatTraversal renders a traversal as it would be written in a template, e.g.
+// `GLOBAL.devices[0].name`.
+func formatTraversal(traversal hcl.Traversal) string {
+	var sb strings.Builder
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			sb.WriteString(s.Name)
+		case hcl.TraverseAttr:
+			sb.WriteString("." + s.Name)
+		case hcl.TraverseIndex:
+			switch {
+			case s.Key.Type() == cty.String:
+				fmt.Fprintf(&sb, "[%q]", s.Key.AsString())
+			case s.Key.Type() == cty.Number:
+				fmt.Fprintf(&sb, "[%s]", s.Key.AsBigFloat().Text('f', -1))
+			default:
+				sb.WriteString("[?]")
+			}
+		case hcl.TraverseSplat:
+			sb.WriteString("[*]")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,132 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// templateAssignment is one entry of a global, group or device templates list:
+// either a template name or an object with a name and an optional when condition.
+type templateAssignment struct {
+	name string
+	when any
+}
+
+// templateAssignments returns the entries of the templates list of m.
+func templateAssignments(m map[string]any) []templateAssignment {
+	var result []templateAssignment
+	for _, v := range getSliceVal(m, "templates") {
+		switch entry := v.(type) {
+		case string:
+			result = append(result, templateAssignment{name: entry})
+		default:
+			if em := toMapStringAny(entry); em != nil {
+				if name := getStringVal(em, "name", ""); name != "" {
+					result = append(result, templateAssignment{name: name, when: em["when"]})
+				}
+			}
+		}
+	}
+	return result
+}
+
+// selectTemplates returns the names of the assigned templates of the given type
+// whose when conditions, on the assignment and on the template itself, hold for
+// vars. Unknown templates and templates of other types are skipped.
+func (rctx *renderContext) selectTemplates(assignments []templateAssignment, templateType string, vars map[string]cty.Value) ([]string, error) {
+	var names []string
+	for _, a := range assignments {
+		tmpl, ok := rctx.templates[a.name]
+		if !ok || getStringVal(tmpl, "type", "") != templateType {
+			continue
+		}
+		ok, err := evaluateWhen(a.when, vars, rctx.functions, rctx.limits)
+		if err != nil {
+			return nil, fmt.Errorf("template %q assignment: %w", a.name, err)
+		}
+		if !ok {
+			continue
+		}
+		ok, err = evaluateWhen(tmpl["when"], vars, rctx.functions, rctx.limits)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", a.name, err)
+		}
+		if ok {
+			names = append(names, a.name)
+		}
+	}
+	return names, nil
+}
+
+// evaluateWhen evaluates a when condition. A missing condition holds, a YAML
+// boolean is used as is and a string is evaluated as an HCL expression, e.g.
+// `role == "leaf"`, or as a template if it contains `${`. The result must be a
+// boolean or a string convertible to one.
+func evaluateWhen(when any, vars map[string]cty.Value, funcs map[string]function.Function, limits *templateLimits) (bool, error) {
+	var src string
+	switch w := when.(type) {
+	case nil:
+		return true, nil
+	case bool:
+		return w, nil
+	case string:
+		src = strings.TrimSpace(w)
+	default:
+		return false, fmt.Errorf("when: expected a boolean or an expression string, got %T", when)
+	}
+	if src == "" {
+		return false, fmt.Errorf("when: empty expression")
+	}
+
+	var expr hclsyntax.Expression
+	var diags hcl.Diagnostics
+	if strings.Contains(src, "${") {
+		expr, diags = hclsyntax.ParseTemplate([]byte(src), "when", hcl.Pos{Line: 1, Column: 1})
+	} else {
+		expr, diags = hclsyntax.ParseExpression([]byte(src), "when", hcl.Pos{Line: 1, Column: 1})
+	}
+	if diags.HasErrors() {
+		return false, fmt.Errorf("when: parsing %q: %s", src, diags.Error())
+	}
+	limits.begin()
+	limits.instrument(expr)
+
+	val, diags := expr.Value(&hcl.EvalContext{
+		Variables: vars,
+		Functions: funcs,
+	})
+	if err := limits.error(); err != nil {
+		return false, err
+	}
+	if diags.HasErrors() {
+		return false, fmt.Errorf("when: evaluating %q: %s", src, diags.Error())
+	}
+	b, err := convert.Convert(val, cty.Bool)
+	if err != nil || b.IsNull() || !b.IsKnown() {
+		return false, fmt.Errorf("when: %q must evaluate to a boolean, got %s", src, val.Type().FriendlyName())
+	}
+	return b.True(), nil
+}
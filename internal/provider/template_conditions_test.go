@@ -0,0 +1,121 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestEvaluateWhen(t *testing.T) {
+	vars := map[string]cty.Value{
+		"role":    cty.StringVal("leaf"),
+		"version": cty.StringVal("10.3(2)"),
+		"vpc":     cty.True,
+	}
+	funcs := hclTemplateFunctions()
+
+	tests := []struct {
+		when     any
+		expected bool
+		wantErr  string
+	}{
+		{when: nil, expected: true},
+		{when: true, expected: true},
+		{when: false, expected: false},
+		{when: `role == "leaf"`, expected: true},
+		{when: `role == "spine"`, expected: false},
+		{when: `role == "leaf" && startswith(version, "10.")`, expected: true},
+		{when: `vpc`, expected: true},
+		{when: `${vpc}`, expected: true},
+		{when: `"false"`, expected: false},
+		{when: "", wantErr: "empty expression"},
+		{when: `role ==`, wantErr: "parsing"},
+		{when: `missing == 1`, wantErr: "evaluating"},
+		{when: `role`, wantErr: "must evaluate to a boolean"},
+		{when: 1, wantErr: "expected a boolean or an expression string"},
+	}
+
+	for _, tt := range tests {
+		got, err := evaluateWhen(tt.when, vars, funcs, nil)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("when %v: expected error containing %q, got %v", tt.when, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("when %v: unexpected error: %v", tt.when, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("when %v: expected %v, got %v", tt.when, tt.expected, got)
+		}
+	}
+}
+
+func TestSelectTemplates(t *testing.T) {
+	rctx := &renderContext{
+		templates: map[string]map[string]any{
+			"base":   {"name": "base", "type": "model"},
+			"vpc":    {"name": "vpc", "type": "model", "when": `role == "leaf"`},
+			"banner": {"name": "banner", "type": "cli"},
+		},
+		functions: hclTemplateFunctions(),
+	}
+	device := map[string]any{
+		"templates": []any{
+			"base",
+			"vpc",
+			"banner",
+			"missing",
+			map[string]any{"name": "base", "when": "false"},
+			map[string]any{"name": "vpc", "when": `site == "dc1"`},
+		},
+	}
+	assignments := templateAssignments(device)
+	if len(assignments) != 6 {
+		t.Fatalf("expected 6 assignments, got %d", len(assignments))
+	}
+
+	vars := map[string]cty.Value{"role": cty.StringVal("leaf"), "site": cty.StringVal("dc1")}
+	got, err := rctx.selectTemplates(assignments, "model", vars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"base", "vpc", "vpc"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	vars["role"] = cty.StringVal("spine")
+	got, err = rctx.selectTemplates(assignments, "model", vars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"base"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	_, err = rctx.selectTemplates(assignments, "model", map[string]cty.Value{"role": cty.StringVal("leaf")})
+	if err == nil || !strings.Contains(err.Error(), `template "vpc" assignment: when: evaluating`) {
+		t.Errorf("expected assignment error, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// maxTemplateFunctionDepth limits nested calls of user-defined template functions,
+// so that recursive definitions fail instead of exhausting the stack.
+const maxTemplateFunctionDepth = 32
+
+// templateFunctionNameRegexp matches valid names of user-defined template functions.
+var templateFunctionNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Parameter types of user-defined template functions
+const (
+	TemplateParamAny    = "any"
+	TemplateParamString = "string"
+	TemplateParamNumber = "number"
+	TemplateParamBool   = "bool"
+	TemplateParamList   = "list"
+	TemplateParamObject = "object"
+)
+
+// ValidTemplateParamTypes defines valid parameter type values
+var ValidTemplateParamTypes = map[string]bool{
+	TemplateParamAny:    true,
+	TemplateParamString: true,
+	TemplateParamNumber: true,
+	TemplateParamBool:   true,
+	TemplateParamList:   true,
+	TemplateParamObject: true,
+}
+
+// templateFunctionCalls tracks the user-defined function calls in progress.
+type templateFunctionCalls struct {
+	depth int
+	// err holds the first error of a nested call. Outer calls return it unchanged
+	// instead of wrapping it once per level.
+	err error
+}
+
+// templateFunctionParam is a declared parameter of a user-defined template function.
+type templateFunctionParam struct {
+	name     string
+	typeName string
+}
+
+// compileTemplateFunctions returns the built-in template functions plus the
+// user-defined functions declared as `type: function` entries of the model's
+// templates list. Each entry declares its `parameters`, either as names or as
+// objects with `name` and `type`, and an HCL `expression` evaluated with the
+// parameters as variables. User-defined functions can call each other. If limits
+// is not nil, the functions and the user-defined expressions are subject to it.
+func compileTemplateFunctions(templates []any, limits *templateLimits) (map[string]function.Function, error) {
+	funcs := hclTemplateFunctions()
+	limits.install(funcs)
+	calls := &templateFunctionCalls{}
+	for _, t := range templates {
+		tm, ok := t.(map[string]any)
+		if !ok || getStringVal(tm, "type", "") != "function" {
+			continue
+		}
+		name := getStringVal(tm, "name", "")
+		if !templateFunctionNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("template function name %q is invalid: must start with a letter or underscore and contain only letters, digits and underscores", name)
+		}
+		if _, exists := funcs[name]; exists || name == "include" {
+			return nil, fmt.Errorf("template function %q conflicts with an existing function", name)
+		}
+		f, err := compileTemplateFunction(name, tm, funcs, calls, limits)
+		if err != nil {
+			return nil, fmt.Errorf("template function %q: %w", name, err)
+		}
+		funcs[name] = f
+	}
+	return funcs, nil
+}
+
+// compileTemplateFunction builds one user-defined function. funcs is the function
+// map the expression is evaluated with.
+func compileTemplateFunction(name string, tm map[string]any, funcs map[string]function.Function, calls *templateFunctionCalls, limits *templateLimits) (function.Function, error) {
+	params, err := parseTemplateFunctionParams(getSliceVal(tm, "parameters"))
+	if err != nil {
+		return function.Function{}, err
+	}
+
+	source := getStringVal(tm, "expression", "")
+	if strings.TrimSpace(source) == "" {
+		return function.Function{}, fmt.Errorf("expression is required")
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(source), name, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return function.Function{}, fmt.Errorf("parsing expression: %s", diags.Error())
+	}
+	limits.instrument(expr)
+
+	specParams := make([]function.Parameter, len(params))
+	for i, p := range params {
+		specParams[i] = function.Parameter{
+			Name:             p.name,
+			Type:             cty.DynamicPseudoType,
+			AllowNull:        true,
+			AllowDynamicType: true,
+		}
+	}
+
+	return function.New(&function.Spec{
+		Params: specParams,
+		Type:   function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if calls.depth >= maxTemplateFunctionDepth {
+				return cty.NilVal, calls.fail(fmt.Errorf("template function %q exceeded the maximum call depth of %d", name, maxTemplateFunctionDepth))
+			}
+			calls.depth++
+			defer func() {
+				calls.depth--
+				if calls.depth == 0 {
+					calls.err = nil
+				}
+			}()
+
+			vars := make(map[string]cty.Value, len(params))
+			for i, p := range params {
+				v, err := checkTemplateFunctionArg(args[i], p.typeName)
+				if err != nil {
+					return cty.NilVal, function.NewArgErrorf(i, "%s: %s", p.name, err)
+				}
+				vars[p.name] = v
+			}
+
+			val, diags := expr.Value(&hcl.EvalContext{Variables: vars, Functions: funcs})
+			if err := limits.error(); err != nil {
+				return cty.NilVal, err
+			}
+			if diags.HasErrors() {
+				return cty.NilVal, calls.fail(fmt.Errorf("template function %q: %s", name, diags.Error()))
+			}
+			return val, nil
+		},
+	}), nil
+}
+
+// fail records the first error of a nested call and returns it.
+func (c *templateFunctionCalls) fail(err error) error {
+	if c.err == nil {
+		c.err = err
+	}
+	return c.err
+}
+
+// parseTemplateFunctionParams parses the parameters of a function declaration.
+func parseTemplateFunctionParams(raw []any) ([]templateFunctionParam, error) {
+	params := make([]templateFunctionParam, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for i, r := range raw {
+		var p templateFunctionParam
+		switch val := r.(type) {
+		case string:
+			p = templateFunctionParam{name: val, typeName: TemplateParamAny}
+		case map[string]any:
+			p = templateFunctionParam{name: getStringVal(val, "name", ""), typeName: getStringVal(val, "type", TemplateParamAny)}
+		default:
+			return nil, fmt.Errorf("parameter %d must be a name or an object with name and type", i)
+		}
+		if !templateFunctionNameRegexp.MatchString(p.name) {
+			return nil, fmt.Errorf("parameter name %q is invalid", p.name)
+		}
+		if seen[p.name] {
+			return nil, fmt.Errorf("duplicate parameter %q", p.name)
+		}
+		if !ValidTemplateParamTypes[p.typeName] {
+			return nil, fmt.Errorf("parameter %q has invalid type '%s'. Must be one of: 'any', 'string', 'number', 'bool', 'list', 'object'", p.name, p.typeName)
+		}
+		seen[p.name] = true
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// checkTemplateFunctionArg checks an argument against its declared parameter type,
+// converting primitive values like HCL does (e.g. a number to a string).
+func checkTemplateFunctionArg(v cty.Value, typeName string) (cty.Value, error) {
+	if v.IsNull() || !v.IsKnown() {
+		return v, nil
+	}
+	ty := v.Type()
+	switch typeName {
+	case TemplateParamString:
+		return convert.Convert(v, cty.String)
+	case TemplateParamNumber:
+		return convert.Convert(v, cty.Number)
+	case TemplateParamBool:
+		return convert.Convert(v, cty.Bool)
+	case TemplateParamList:
+		if !ty.IsListType() && !ty.IsTupleType() && !ty.IsSetType() {
+			return cty.NilVal, fmt.Errorf("list required, got %s", ty.FriendlyName())
+		}
+	case TemplateParamObject:
+		if !ty.IsObjectType() && !ty.IsMapType() {
+			return cty.NilVal, fmt.Errorf("object required, got %s", ty.FriendlyName())
+		}
+	}
+	return v, nil
+}
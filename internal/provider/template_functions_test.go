@@ -0,0 +1,131 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestCompileTemplateFunctions(t *testing.T) {
+	templates := []any{
+		map[string]any{
+			"name":       "uplink_description",
+			"type":       "function",
+			"parameters": []any{"peer", map[string]any{"name": "port", "type": "string"}},
+			"expression": `"uplink to ${upper(peer)} ${port}"`,
+		},
+		map[string]any{
+			"name":       "spine_uplink",
+			"type":       "function",
+			"parameters": []any{map[string]any{"name": "index", "type": "number"}},
+			"expression": `uplink_description("spine${index}", "Ethernet1/${index}")`,
+		},
+		map[string]any{"name": "base_cli", "type": "cli", "content": "hostname x"},
+	}
+	funcs, err := compileTemplateFunctions(templates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tmpl     string
+		expected string
+	}{
+		{`${uplink_description("spine1", 49)}`, "uplink to SPINE1 49"},
+		{`${spine_uplink("2")}`, "uplink to SPINE2 Ethernet1/2"},
+		{`${upper("builtin")}`, "BUILTIN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			result, err := renderHCLTemplateWithFunctions(tt.tmpl, map[string]cty.Value{}, funcs, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCompileTemplateFunctions_TypeCheck(t *testing.T) {
+	funcs, err := compileTemplateFunctions([]any{
+		map[string]any{
+			"name":       "first",
+			"type":       "function",
+			"parameters": []any{map[string]any{"name": "items", "type": "list"}},
+			"expression": `items[0]`,
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = renderHCLTemplateWithFunctions(`${first("a")}`, map[string]cty.Value{}, funcs, nil)
+	if err == nil {
+		t.Fatal("expected type error")
+	}
+	if !strings.Contains(err.Error(), "list required") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCompileTemplateFunctions_RecursionLimit(t *testing.T) {
+	funcs, err := compileTemplateFunctions([]any{
+		map[string]any{
+			"name":       "loop",
+			"type":       "function",
+			"parameters": []any{"n"},
+			"expression": `loop(n + 1)`,
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = renderHCLTemplateWithFunctions(`${loop(0)}`, map[string]cty.Value{}, funcs, nil)
+	if err == nil {
+		t.Fatal("expected recursion error")
+	}
+	if !strings.Contains(err.Error(), "exceeded the maximum call depth of 32") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCompileTemplateFunctions_Errors(t *testing.T) {
+	tests := map[string]map[string]any{
+		"invalid name":      {"name": "bad-name", "type": "function", "expression": "1"},
+		"builtin conflict":  {"name": "upper", "type": "function", "expression": "1"},
+		"include conflict":  {"name": "include", "type": "function", "expression": "1"},
+		"missing body":      {"name": "f", "type": "function"},
+		"parse error":       {"name": "f", "type": "function", "expression": "1 +"},
+		"invalid type":      {"name": "f", "type": "function", "parameters": []any{map[string]any{"name": "x", "type": "tuple"}}, "expression": "x"},
+		"duplicate param":   {"name": "f", "type": "function", "parameters": []any{"x", "x"}, "expression": "x"},
+		"invalid parameter": {"name": "f", "type": "function", "parameters": []any{1}, "expression": "1"},
+	}
+	for name, tmpl := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := compileTemplateFunctions([]any{tmpl}, nil); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// templateIncluder renders CLI and file templates with an include() function that
+// renders another template with the current variables plus optional overrides.
+type templateIncluder struct {
+	lookup    func(name string) (string, error)
+	functions map[string]function.Function
+	limits    *templateLimits
+	chain     []string
+	// err holds the last error raised by an include, prefixed with its include
+	// chain. It replaces the nested HCL diagnostics of the outer templates if it
+	// caused them, and is ignored if it was handled, e.g. by try() or can().
+	err error
+}
+
+// renderTemplate renders a CLI or file template of the render context. The template
+// and the templates it includes share one set of resource limits.
+func (rctx *renderContext) renderTemplate(name, content string, vars map[string]cty.Value) (string, error) {
+	rctx.limits.begin()
+	inc := &templateIncluder{lookup: rctx.templateContent, functions: rctx.functions, limits: rctx.limits}
+	return inc.render(name, content, vars)
+}
+
+// templateContent returns the content of a template that can be included: a CLI
+// or file template from the model's templates list, or an entry of file_templates.
+func (rctx *renderContext) templateContent(name string) (string, error) {
+	if tmpl, ok := rctx.templates[name]; ok {
+		switch tmplType := getStringVal(tmpl, "type", ""); tmplType {
+		case "cli":
+			return getStringVal(tmpl, "content", ""), nil
+		case "file":
+			filePath := getStringVal(tmpl, "file", "")
+			content, ok := rctx.fileTemplates[filePath]
+			if !ok {
+				return "", fmt.Errorf("file template %q (path %q) not found in file_templates parameter", name, filePath)
+			}
+			return content, nil
+		default:
+			return "", fmt.Errorf("template %q of type %q cannot be included", name, tmplType)
+		}
+	}
+	if content, ok := rctx.fileTemplates[name]; ok {
+		return content, nil
+	}
+	return "", fmt.Errorf("template %q not found in templates or file_templates", name)
+}
+
+// render evaluates content as the template name, pushing it onto the include chain.
+func (inc *templateIncluder) render(name, content string, vars map[string]cty.Value) (string, error) {
+	inc.chain = append(inc.chain, name)
+	defer func() { inc.chain = inc.chain[:len(inc.chain)-1] }()
+
+	funcs := make(map[string]function.Function, len(inc.functions)+1)
+	for k, f := range inc.functions {
+		funcs[k] = f
+	}
+	funcs["include"] = inc.includeFunc(vars)
+	rendered, err := renderHCLTemplateWithFunctions(content, vars, funcs, inc.limits)
+	if err != nil {
+		if inc.err != nil && causedByFunctionError(err, inc.err) {
+			return "", inc.err
+		}
+		return "", err
+	}
+	return rendered, nil
+}
+
+// causedByFunctionError reports whether the template evaluation error err has a
+// diagnostic raised by a function call that returned target.
+func causedByFunctionError(err, target error) bool {
+	var diags hcl.Diagnostics
+	if !errors.As(err, &diags) {
+		return false
+	}
+	for _, diag := range diags {
+		if extra, ok := hcl.DiagnosticExtra[hclsyntax.FunctionCallDiagExtra](diag); ok && errors.Is(extra.FunctionCallError(), target) {
+			return true
+		}
+	}
+	return false
+}
+
+// includeFunc returns the include(name, vars) function for a template rendered
+// with vars.
+func (inc *templateIncluder) includeFunc(vars map[string]cty.Value) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "name", Type: cty.String},
+		},
+		VarParam: &function.Parameter{
+			Name:      "vars",
+			Type:      cty.DynamicPseudoType,
+			AllowNull: true,
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if len(args) > 2 {
+				return cty.NilVal, function.NewArgErrorf(2, "include accepts at most one variables object")
+			}
+			var overrides cty.Value
+			if len(args) == 2 {
+				overrides = args[1]
+			}
+			rendered, err := inc.include(args[0].AsString(), vars, overrides)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			return cty.StringVal(rendered), nil
+		},
+	})
+}
+
+// include renders the named template with vars plus the attributes of overrides.
+func (inc *templateIncluder) include(name string, vars map[string]cty.Value, overrides cty.Value) (string, error) {
+	chain := append(inc.chain[:len(inc.chain):len(inc.chain)], name)
+	for _, n := range inc.chain {
+		if n == name {
+			return "", inc.fail(fmt.Errorf("include cycle: %s", strings.Join(chain, " -> ")))
+		}
+	}
+
+	content, err := inc.lookup(name)
+	if err != nil {
+		return "", inc.fail(fmt.Errorf("include %s: %w", strings.Join(chain, " -> "), err))
+	}
+
+	includeVars := vars
+	if overrides != cty.NilVal && !overrides.IsNull() {
+		if !overrides.Type().IsObjectType() && !overrides.Type().IsMapType() {
+			return "", inc.fail(fmt.Errorf("include %s: variables must be an object, got %s", strings.Join(chain, " -> "), overrides.Type().FriendlyName()))
+		}
+		includeVars = make(map[string]cty.Value, len(vars))
+		for k, v := range vars {
+			includeVars[k] = v
+		}
+		for it := overrides.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			includeVars[k.AsString()] = v
+		}
+	}
+
+	rendered, err := inc.render(name, content, includeVars)
+	if err != nil {
+		if err == inc.err {
+			// Raised by a nested include, already prefixed with the include chain
+			return "", err
+		}
+		return "", inc.fail(fmt.Errorf("include %s: %w", strings.Join(chain, " -> "), err))
+	}
+	return rendered, nil
+}
+
+// fail records err as the include error to report and returns it.
+func (inc *templateIncluder) fail(err error) error {
+	inc.err = err
+	return err
+}
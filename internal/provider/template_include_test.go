@@ -0,0 +1,119 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func testIncludeContext(templates map[string]string) *renderContext {
+	rctx := &renderContext{
+		templates:     map[string]map[string]any{},
+		fileTemplates: map[string]string{},
+		functions:     hclTemplateFunctions(),
+	}
+	for name, content := range templates {
+		rctx.templates[name] = map[string]any{"name": name, "type": "cli", "content": content}
+	}
+	return rctx
+}
+
+func TestRenderTemplate_Include(t *testing.T) {
+	rctx := testIncludeContext(map[string]string{
+		"banner": "${title}: ${name}",
+	})
+	rctx.fileTemplates["footer.tpl"] = "end"
+	vars := map[string]cty.Value{"name": cty.StringVal("leaf1"), "title": cty.StringVal("device")}
+
+	result, err := rctx.renderTemplate("main", `${include("banner", { title = "switch" })}|${include("banner")}|${include("footer.tpl")}`, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "switch: leaf1|device: leaf1|end"; result != expected {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestRenderTemplate_IncludeCycle(t *testing.T) {
+	rctx := testIncludeContext(map[string]string{
+		"a": `${include("b")}`,
+		"b": `${include("c")}`,
+		"c": `${include("a")}`,
+	})
+
+	_, err := rctx.renderTemplate("a", rctx.templates["a"]["content"].(string), nil)
+	if err == nil {
+		t.Fatal("expected cycle error")
+	}
+	if expected := "include cycle: a -> b -> c -> a"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestRenderTemplate_IncludeErrorShowsChain(t *testing.T) {
+	rctx := testIncludeContext(map[string]string{
+		"a": `${include("b")}`,
+		"b": `${missing_var}`,
+	})
+
+	_, err := rctx.renderTemplate("a", rctx.templates["a"]["content"].(string), map[string]cty.Value{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.HasPrefix(err.Error(), "include a -> b: evaluating template: ") {
+		t.Errorf("expected error to show the include chain, got: %v", err)
+	}
+}
+
+func TestRenderTemplate_IncludeNotFound(t *testing.T) {
+	rctx := testIncludeContext(map[string]string{})
+
+	_, err := rctx.renderTemplate("main", `${include("nope")}`, nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), `include main -> nope: template "nope" not found`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRenderTemplate_IncludeErrorHandledByTry(t *testing.T) {
+	rctx := testIncludeContext(map[string]string{
+		"a": `${try(include("nope"), "fallback")}`,
+	})
+
+	result, err := rctx.renderTemplate("main", `${include("a")}|${can(include("nope"))}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "fallback|false"; result != expected {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+
+	// A later unrelated error is reported instead of the handled include error
+	_, err = rctx.renderTemplate("main", `${try(include("nope"), "fallback")}${missing_var}`, map[string]cty.Value{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if strings.Contains(err.Error(), "nope") || !strings.Contains(err.Error(), "missing_var") {
+		t.Errorf("expected the undefined variable error, got: %v", err)
+	}
+}
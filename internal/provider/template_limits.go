@@ -0,0 +1,305 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Default limits for the evaluation of a single template
+const (
+	DefaultMaxTemplateOutputSize     = 10 * 1024 * 1024
+	DefaultMaxTemplateCollectionSize = 100000
+)
+
+// Names of the guard functions inserted into templates by templateLimits.instrument.
+// They are not valid HCL identifiers, so templates cannot call them directly.
+const (
+	templateOutputGuardName     = "template:output"
+	templateCollectionGuardName = "template:collection"
+)
+
+// templateLimits bounds the resources used while evaluating templates. Templates
+// are instrumented so that every piece of output adds to a running total and every
+// collection iterated by a for expression is checked, and range and setproduct
+// check the size of their result. Every check also honors cancellation of ctx.
+// A nil *templateLimits imposes no limits.
+type templateLimits struct {
+	ctx               context.Context
+	maxOutputSize     int
+	maxCollectionSize int
+	// output counts the bytes produced by the template being rendered, including
+	// the templates it includes.
+	output int
+	// err holds the first limit error of the template being rendered. It is
+	// returned instead of the HCL diagnostics, which could otherwise hide it
+	// behind try() or wrap it in the internal guard function names.
+	err error
+}
+
+func newTemplateLimits(ctx context.Context, maxOutputSize, maxCollectionSize int) *templateLimits {
+	return &templateLimits{
+		ctx:               ctx,
+		maxOutputSize:     maxOutputSize,
+		maxCollectionSize: maxCollectionSize,
+	}
+}
+
+// begin resets the counters before rendering a new template.
+func (l *templateLimits) begin() {
+	if l == nil {
+		return
+	}
+	l.output = 0
+	l.err = nil
+}
+
+// error returns the limit error raised while rendering the current template.
+func (l *templateLimits) error() error {
+	if l == nil {
+		return nil
+	}
+	return l.err
+}
+
+// fail records the first limit error and returns it.
+func (l *templateLimits) fail(err error) error {
+	if l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// checkContext reports cancellation of the function context.
+func (l *templateLimits) checkContext() error {
+	if l == nil || l.ctx == nil {
+		return nil
+	}
+	if err := l.ctx.Err(); err != nil {
+		return l.fail(fmt.Errorf("template rendering cancelled: %w", err))
+	}
+	return nil
+}
+
+// checkOutput checks the final result of a template against the output limit.
+func (l *templateLimits) checkOutput(size int) error {
+	if l == nil || size <= l.maxOutputSize {
+		return nil
+	}
+	return l.fail(fmt.Errorf("template output of %d bytes exceeds the maximum output size of %d bytes", size, l.maxOutputSize))
+}
+
+// install replaces range and setproduct in funcs with size-checked versions and
+// adds the guard functions used by instrumented templates.
+func (l *templateLimits) install(funcs map[string]function.Function) {
+	if l == nil {
+		return
+	}
+	if f, ok := funcs["range"]; ok {
+		funcs["range"] = l.limitCollectionFunc("range", f, rangeSize)
+	}
+	if f, ok := funcs["setproduct"]; ok {
+		funcs["setproduct"] = l.limitCollectionFunc("setproduct", f, setProductSize)
+	}
+	funcs[templateOutputGuardName] = l.guardFunc(l.countOutput)
+	funcs[templateCollectionGuardName] = l.guardFunc(l.checkCollection)
+}
+
+// instrument rewrites a parsed template or expression so that the output of
+// every template part and every for expression collection passes through a
+// guard function.
+func (l *templateLimits) instrument(expr hclsyntax.Expression) {
+	if l == nil {
+		return
+	}
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		switch n := node.(type) {
+		case *hclsyntax.TemplateExpr:
+			for i, part := range n.Parts {
+				if countsAsTemplateOutput(part) {
+					n.Parts[i] = guardCall(templateOutputGuardName, part)
+				}
+			}
+		case *hclsyntax.ForExpr:
+			n.CollExpr = guardCall(templateCollectionGuardName, n.CollExpr)
+		}
+		return nil
+	})
+}
+
+// countsAsTemplateOutput reports whether a template part produces output of its
+// own. Parts built from nested templates, such as %{for} and %{if} directives and
+// include() calls, are skipped since the nested template parts are counted.
+func countsAsTemplateOutput(part hclsyntax.Expression) bool {
+	switch p := part.(type) {
+	case *hclsyntax.TemplateJoinExpr, *hclsyntax.TemplateExpr:
+		return false
+	case *hclsyntax.ConditionalExpr:
+		_, trueTmpl := p.TrueResult.(*hclsyntax.TemplateExpr)
+		_, falseTmpl := p.FalseResult.(*hclsyntax.TemplateExpr)
+		return !trueTmpl || !falseTmpl
+	case *hclsyntax.FunctionCallExpr:
+		return p.Name != "include"
+	}
+	return true
+}
+
+// guardCall wraps expr in a call to the named guard function.
+func guardCall(name string, expr hclsyntax.Expression) hclsyntax.Expression {
+	rng := expr.Range()
+	return &hclsyntax.FunctionCallExpr{
+		Name:            name,
+		Args:            []hclsyntax.Expression{expr},
+		NameRange:       rng,
+		OpenParenRange:  rng,
+		CloseParenRange: rng,
+	}
+}
+
+// guardFunc returns a function that runs check on its argument and returns the
+// argument unchanged.
+func (l *templateLimits) guardFunc(check func(v cty.Value) error) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name:             "value",
+				Type:             cty.DynamicPseudoType,
+				AllowNull:        true,
+				AllowUnknown:     true,
+				AllowDynamicType: true,
+				AllowMarked:      true,
+			},
+		},
+		Type: func(args []cty.Value) (cty.Type, error) {
+			return args[0].Type(), nil
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if err := l.checkContext(); err != nil {
+				return cty.NilVal, err
+			}
+			if err := check(args[0]); err != nil {
+				return cty.NilVal, err
+			}
+			return args[0], nil
+		},
+	})
+}
+
+// countOutput adds the length of a string template part to the output total.
+func (l *templateLimits) countOutput(v cty.Value) error {
+	v, _ = v.Unmark()
+	if v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+		return nil
+	}
+	l.output += len(v.AsString())
+	if l.output > l.maxOutputSize {
+		return l.fail(fmt.Errorf("template output exceeds the maximum output size of %d bytes", l.maxOutputSize))
+	}
+	return nil
+}
+
+// checkCollection checks the size of a collection iterated by a for expression.
+func (l *templateLimits) checkCollection(v cty.Value) error {
+	v, _ = v.Unmark()
+	if v.IsNull() || !v.IsKnown() || !v.CanIterateElements() {
+		return nil
+	}
+	if n := v.LengthInt(); n > l.maxCollectionSize {
+		return l.fail(fmt.Errorf("for expression over %d elements exceeds the maximum collection size of %d", n, l.maxCollectionSize))
+	}
+	return nil
+}
+
+// limitCollectionFunc wraps a function returning a collection so that it fails
+// before building a result larger than the collection limit.
+func (l *templateLimits) limitCollectionFunc(name string, f function.Function, size func(args []cty.Value) int) function.Function {
+	return function.New(&function.Spec{
+		Description: f.Description(),
+		Params:      f.Params(),
+		VarParam:    f.VarParam(),
+		Type:        f.ReturnTypeForValues,
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if err := l.checkContext(); err != nil {
+				return cty.NilVal, err
+			}
+			if n := size(args); n > l.maxCollectionSize {
+				return cty.NilVal, l.fail(fmt.Errorf("%s result of %d elements exceeds the maximum collection size of %d", name, n, l.maxCollectionSize))
+			}
+			return f.Call(args)
+		},
+	})
+}
+
+// rangeSize returns the number of elements range() produces for args, using the
+// same defaults for start and step as range itself.
+func rangeSize(args []cty.Value) int {
+	nums := make([]float64, len(args))
+	for i, a := range args {
+		if a.IsNull() || !a.IsKnown() {
+			return 0
+		}
+		nums[i], _ = a.AsBigFloat().Float64()
+	}
+	var start, end, step float64
+	switch len(nums) {
+	case 1:
+		end, step = nums[0], 1
+	case 2:
+		start, end, step = nums[0], nums[1], 1
+	case 3:
+		start, end, step = nums[0], nums[1], nums[2]
+	default:
+		return 0
+	}
+	if len(nums) < 3 && end < start {
+		step = -1
+	}
+	if step == 0 {
+		return 0
+	}
+	n := math.Ceil((end - start) / step)
+	if n <= 0 {
+		return 0
+	}
+	if n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(n)
+}
+
+// setProductSize returns the number of elements setproduct() produces for args.
+func setProductSize(args []cty.Value) int {
+	total := 1
+	for _, a := range args {
+		if a.IsNull() || !a.IsKnown() || !a.CanIterateElements() {
+			return 0
+		}
+		total *= a.LengthInt()
+		if total > math.MaxInt32 {
+			return math.MaxInt32
+		}
+	}
+	return total
+}
@@ -0,0 +1,170 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// testLimitsRender renders tmpl with limits applied to the built-in functions.
+func testLimitsRender(tmpl string, vars map[string]cty.Value, limits *templateLimits) (string, error) {
+	funcs := hclTemplateFunctions()
+	limits.install(funcs)
+	limits.begin()
+	return renderHCLTemplateWithFunctions(tmpl, vars, funcs, limits)
+}
+
+func TestTemplateLimits_Output(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		max     int
+		wantErr bool
+	}{
+		{name: "within limit", tmpl: "abc${x}def", max: 9},
+		{name: "literal over limit", tmpl: "abc${x}def", max: 8, wantErr: true},
+		{name: "loop over limit", tmpl: "%{ for i in range(100) }xxxxxxxxxx%{ endfor }", max: 500, wantErr: true},
+		{name: "directives counted once", tmpl: "%{ for i in range(10) }%{ if true }ab${x}%{ endif }%{ endfor }", max: 50},
+		{name: "single expression", tmpl: `${join("", [for i in range(100) : "xxxxx"])}`, max: 100, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := newTemplateLimits(context.Background(), tt.max, DefaultMaxTemplateCollectionSize)
+			_, err := testLimitsRender(tt.tmpl, map[string]cty.Value{"x": cty.StringVal("xyz")}, limits)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "maximum output size") {
+					t.Fatalf("expected output size error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTemplateLimits_Collection(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		wantErr string
+	}{
+		{name: "range", tmpl: "${length(range(20))}", wantErr: "range result of 20 elements"},
+		{name: "range within limit", tmpl: "r=${length(range(2, 12))}"},
+		{name: "setproduct", tmpl: `${length(setproduct(["a", "b", "c", "d"], ["x", "y", "z"]))}`, wantErr: "setproduct result of 12 elements"},
+		{name: "for expression", tmpl: "${length([for s in split(\",\", \"a,b,c,d,e,f,g,h,i,j,k\") : s])}", wantErr: "for expression over 11 elements"},
+		{name: "not hidden by try", tmpl: "${try(length(range(20)), 0)}", wantErr: "range result of 20 elements"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := newTemplateLimits(context.Background(), DefaultMaxTemplateOutputSize, 10)
+			_, err := testLimitsRender(tt.tmpl, map[string]cty.Value{}, limits)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTemplateLimits_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limits := newTemplateLimits(ctx, DefaultMaxTemplateOutputSize, DefaultMaxTemplateCollectionSize)
+
+	_, err := testLimitsRender("%{ for i in range(3) }${i}%{ endfor }", map[string]cty.Value{}, limits)
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+}
+
+func TestTemplateLimits_UserFunction(t *testing.T) {
+	limits := newTemplateLimits(context.Background(), DefaultMaxTemplateOutputSize, 5)
+	funcs, err := compileTemplateFunctions([]any{
+		map[string]any{
+			"name":       "double",
+			"type":       "function",
+			"parameters": []any{"items"},
+			"expression": `[for i in items : i * 2]`,
+		},
+	}, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits.begin()
+	_, err = renderHCLTemplateWithFunctions("${length(double([1, 2, 3, 4, 5, 6]))}", map[string]cty.Value{}, funcs, limits)
+	if err == nil || !strings.Contains(err.Error(), "for expression over 6 elements") {
+		t.Fatalf("expected collection size error, got %v", err)
+	}
+}
+
+func TestTemplateLimits_IncludeSharesOutput(t *testing.T) {
+	limits := newTemplateLimits(context.Background(), 10, DefaultMaxTemplateCollectionSize)
+	rctx := testIncludeContext(map[string]string{
+		"part": "123456",
+	})
+	rctx.limits = limits
+	limits.install(rctx.functions)
+
+	if _, err := rctx.renderTemplate("main", `${include("part")}`, map[string]cty.Value{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := rctx.renderTemplate("main", `${include("part")}${include("part")}`, map[string]cty.Value{})
+	if err == nil || !strings.Contains(err.Error(), "maximum output size") {
+		t.Fatalf("expected output size error, got %v", err)
+	}
+}
+
+func TestRangeSize(t *testing.T) {
+	tests := []struct {
+		args     []int64
+		expected int
+	}{
+		{args: []int64{5}, expected: 5},
+		{args: []int64{-3}, expected: 3},
+		{args: []int64{2, 12}, expected: 10},
+		{args: []int64{12, 2}, expected: 10},
+		{args: []int64{0, 10, 3}, expected: 4},
+		{args: []int64{10, 0, -5}, expected: 2},
+		{args: []int64{0, 10, -1}, expected: 0},
+		{args: []int64{0, 10, 0}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		args := make([]cty.Value, len(tt.args))
+		for i, a := range tt.args {
+			args[i] = cty.NumberIntVal(a)
+		}
+		if got := rangeSize(args); got != tt.expected {
+			t.Errorf("rangeSize(%v): expected %d, got %d", tt.args, tt.expected, got)
+		}
+	}
+}
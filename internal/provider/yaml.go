@@ -133,10 +133,50 @@ func (d *yamlDecoder) handleTag(n *ast.TagNode) (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	if value == nil {
+		// Tag without a value, e.g. "asn: !site_asn"
+		return tag + " ", nil
+	}
 
 	return fmt.Sprintf("%s %v", tag, value), nil
 }
 
+// emptyTagMappingSiblings works around goccy/go-yaml attaching the entries that
+// follow a custom tag without a value to the tag, e.g. "a: !site_asn\nb: 1" is
+// parsed as a: !site_asn {b: 1}. If the tagged mapping starts in the column of the
+// key, the tag has no value and the entries are returned as siblings of the key.
+func emptyTagMappingSiblings(mv *ast.MappingValueNode) (string, []*ast.MappingValueNode, bool) {
+	tn, ok := mv.Value.(*ast.TagNode)
+	if !ok || isStandardTag(tn.Start.Value) {
+		return "", nil, false
+	}
+	column := mv.Key.GetToken().Position.Column
+	switch v := tn.Value.(type) {
+	case *ast.MappingNode:
+		if len(v.Values) > 0 && v.Values[0].Key.GetToken().Position.Column == column {
+			return tn.Start.Value, v.Values, true
+		}
+	case *ast.MappingValueNode:
+		if v.Key.GetToken().Position.Column == column {
+			return tn.Start.Value, []*ast.MappingValueNode{v}, true
+		}
+	}
+	return "", nil, false
+}
+
+// emptyTagSequenceSiblings is the sequence counterpart of emptyTagMappingSiblings,
+// e.g. "- !site_asn\n- b" is parsed as [!site_asn [b]].
+func emptyTagSequenceSiblings(item ast.Node, column int) (string, []ast.Node, bool) {
+	tn, ok := item.(*ast.TagNode)
+	if !ok || isStandardTag(tn.Start.Value) {
+		return "", nil, false
+	}
+	if seq, ok := tn.Value.(*ast.SequenceNode); ok && seq.GetToken().Position.Column == column {
+		return tn.Start.Value, seq.Values, true
+	}
+	return "", nil, false
+}
+
 // isStandardTag checks whether a YAML tag is a standard YAML 1.2 tag.
 func isStandardTag(tag string) bool {
 	switch tag {
@@ -263,7 +303,9 @@ func (d *yamlDecoder) handleInteger(n *ast.IntegerNode) (any, error) {
 // handleMapping converts a MappingNode to an *OrderedMap preserving key order.
 func (d *yamlDecoder) handleMapping(n *ast.MappingNode) (any, error) {
 	result := NewOrderedMap(len(n.Values))
-	for _, mv := range n.Values {
+	values := n.Values
+	for i := 0; i < len(values); i++ {
+		mv := values[i]
 		if mv.Key.IsMergeKey() {
 			// Handle merge key (<<) — merge the referenced map into the result
 			mergedVal, err := d.traverseNode(mv.Value)
@@ -299,6 +341,12 @@ func (d *yamlDecoder) handleMapping(n *ast.MappingNode) (any, error) {
 			return nil, err
 		}
 
+		if tag, siblings, ok := emptyTagMappingSiblings(mv); ok {
+			result.Set(key, tag+" ")
+			values = append(append(values[:i+1:i+1], siblings...), values[i+1:]...)
+			continue
+		}
+
 		value, err := d.traverseNode(mv.Value)
 		if err != nil {
 			return nil, err
@@ -350,7 +398,14 @@ func (d *yamlDecoder) extractMapKey(keyNode ast.MapKeyNode) (string, error) {
 // handleSequence converts a SequenceNode to a []any.
 func (d *yamlDecoder) handleSequence(n *ast.SequenceNode) (any, error) {
 	result := make([]any, 0, len(n.Values))
-	for _, val := range n.Values {
+	values := n.Values
+	for i := 0; i < len(values); i++ {
+		val := values[i]
+		if tag, siblings, ok := emptyTagSequenceSiblings(val, n.GetToken().Position.Column); ok {
+			result = append(result, tag+" ")
+			values = append(append(values[:i+1:i+1], siblings...), values[i+1:]...)
+			continue
+		}
 		value, err := d.traverseNode(val)
 		if err != nil {
 			return nil, err
@@ -471,6 +526,33 @@ func (s doubleQuotedString) MarshalYAML() ([]byte, error) {
 	return []byte(strconv.Quote(string(s))), nil
 }
 
+// taggedString is emitted as a tagged YAML scalar (e.g. `!env HOME`) instead of a
+// quoted string, so that tags preserved by tag_mode "preserve" survive a round trip.
+type taggedString struct {
+	tag   string
+	value string
+}
+
+func (s taggedString) MarshalYAML() ([]byte, error) {
+	value, err := goyaml.Marshal(s.value)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s.tag + " " + strings.TrimSuffix(string(value), "\n")), nil
+}
+
+// yamlEncodeTagged is like yamlEncode but emits tag strings ("!env HOME") as YAML
+// tags rather than quoted strings.
+func yamlEncodeTagged(v any) (string, error) {
+	tagged, _ := mapYamlStrings(v, "", func(s, _ string) (any, error) {
+		if tag, arg, ok := parseTagString(s); ok {
+			return taggedString{tag: tag, value: arg}, nil
+		}
+		return s, nil
+	})
+	return yamlEncode(tagged)
+}
+
 // yamlEncode marshals a native Go value to a YAML string using github.com/goccy/go-yaml.
 // It produces block-style YAML with 2-space indentation and indented sequences.
 // *OrderedMap values are converted to goccy/go-yaml MapSlice to preserve key order.
@@ -0,0 +1,122 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+)
+
+// yamlMergeError is returned by mergeYamlDocuments. Summary names the step that
+// failed and is used as the diagnostic summary by the data source.
+type yamlMergeError struct {
+	Summary string
+	Err     error
+}
+
+func (e *yamlMergeError) Error() string {
+	return e.Summary + ": " + e.Err.Error()
+}
+
+func (e *yamlMergeError) Unwrap() error {
+	return e.Err
+}
+
+// mergeYamlDocuments decodes and deep merges a list of YAML strings and returns the
+// merged YAML. SOPS documents are decrypted before merging and YAML tags are handled
+// by resolver according to tagMode: in "resolve" mode tags are resolved per document and "!ref"
+// tags against the merged result, in "preserve" mode tags are written back as YAML
+// tags. Empty documents are skipped. The key paths of the merged values that were
+// set by a YAML tag or decrypted from a SOPS document are returned alongside the output.
+func mergeYamlDocuments(inputs []string, mergeListItems bool, tagMode string, resolver *tagResolver) (string, []string, error) {
+	merged := NewOrderedMap(0)
+	// Tags are resolved per document, so their paths are recorded per document and
+	// mapped through the merge, where list items can end up at a different index
+	tagged := map[string]bool{}
+	for _, input := range inputs {
+		decoded, err := yamlDecode(input)
+		if err != nil {
+			return "", nil, &yamlMergeError{"Error reading YAML string", err}
+		}
+		if decoded == nil {
+			continue
+		}
+
+		paths := sopsEncryptedPaths(decoded)
+		decoded, err = decryptSopsDocument(decoded)
+		if err != nil {
+			return "", nil, &yamlMergeError{"Error decrypting SOPS document", err}
+		}
+		if tagMode == TagModeResolve || tagMode == TagModePreserve {
+			paths = append(paths, taggedPaths(decoded)...)
+		}
+
+		resolved, err := resolver.applyTagMode(decoded, tagMode)
+		if err != nil {
+			return "", nil, &yamlMergeError{"Error resolving YAML tags", err}
+		}
+
+		data, ok := resolved.(*OrderedMap)
+		if !ok {
+			return "", nil, &yamlMergeError{"Error reading YAML string", fmt.Errorf("expected a YAML mapping at the top level")}
+		}
+
+		trace := newMergeTrace()
+		mergeMapsTraced(data, merged, mergeListItems, trace, "", "")
+		// Values set again by this document are no longer tagged, unless by this document
+		for leaf := range configLeaves(data) {
+			delete(tagged, trace.destination(leaf))
+		}
+		for _, path := range paths {
+			tagged[trace.destination(path)] = true
+		}
+	}
+
+	paths := make([]string, 0, len(tagged))
+	for path := range tagged {
+		// Skip paths replaced by a value of a different type in a later document
+		segments, err := parseRefPath(path)
+		if err != nil {
+			continue
+		}
+		if v, err := lookupRefPath(merged, segments); err != nil || v == nil {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var result any = merged
+	if tagMode == TagModeResolve {
+		resolvedRefs, err := resolveYamlRefs(merged)
+		if err != nil {
+			return "", nil, &yamlMergeError{"Error resolving YAML references", err}
+		}
+		result = resolvedRefs
+	}
+
+	encode := yamlEncode
+	if tagMode == TagModePreserve {
+		encode = yamlEncodeTagged
+	}
+	output, err := encode(result)
+	if err != nil {
+		return "", nil, &yamlMergeError{"Error converting result to YAML", err}
+	}
+	return output, paths, nil
+}
@@ -0,0 +1,104 @@
+// Copyright © 2022 Cisco Systems, Inc. and its affiliates.
+// All rights reserved.
+//
+// Licensed under the Mozilla Public License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://mozilla.org/MPL/2.0/
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeYamlDocuments_TaggedPaths(t *testing.T) {
+	t.Setenv("MERGE_SITE", "dc1")
+	t.Setenv("MERGE_PASSWORD", "secret")
+	resolver, err := newTagResolverFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		inputs []string
+		mode   string
+		paths  []string
+	}{
+		{
+			// The resolved item merges into devices[0], the unresolved one would not
+			name:   "merged list item",
+			inputs: []string{"devices:\n  - name: leaf1\n    site: dc1\n", "devices:\n  - name: leaf1\n    site: !env MERGE_SITE\n    password: !env MERGE_PASSWORD\n"},
+			mode:   TagModeResolve,
+			paths:  []string{"devices[0].password", "devices[0].site"},
+		},
+		{
+			name:   "appended list item",
+			inputs: []string{"devices:\n  - name: leaf1\n", "devices:\n  - name: leaf2\n    password: !env MERGE_PASSWORD\n"},
+			mode:   TagModeResolve,
+			paths:  []string{"devices[1].password"},
+		},
+		{
+			name:   "overridden",
+			inputs: []string{"password: !env MERGE_PASSWORD\nsite: !env MERGE_SITE\n", "password: plain\n"},
+			mode:   TagModeResolve,
+			paths:  []string{"site"},
+		},
+		{
+			name:   "replaced by scalar",
+			inputs: []string{"config: !yaml \"a: !env MERGE_PASSWORD\"\n", "config: plain\n"},
+			mode:   TagModeResolve,
+			paths:  []string{},
+		},
+		{
+			name:   "preserve",
+			inputs: []string{"devices:\n  - name: leaf1\n", "devices:\n  - name: leaf1\n    password: !env MERGE_PASSWORD\n"},
+			mode:   TagModePreserve,
+			paths:  []string{"devices[0].password"},
+		},
+		{
+			name:   "strip",
+			inputs: []string{"password: !env MERGE_PASSWORD\n"},
+			mode:   TagModeStrip,
+			paths:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		_, paths, err := mergeYamlDocuments(tt.inputs, true, tt.mode, resolver)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(paths, tt.paths) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.paths, paths)
+		}
+	}
+}
+
+func TestMergeYamlDocuments_SopsPaths(t *testing.T) {
+	identity := testAgeIdentity(t)
+	resolver, err := newTagResolverFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := []string{"device:\n  users:\n    - root\n", testSopsDocument(t, identity)}
+	_, paths, err := mergeYamlDocuments(inputs, true, TagModeResolve, resolver)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"device.asn", "device.enabled", "device.name", "device.users[1]"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}